@@ -0,0 +1,73 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VlanRange is the vlans From to To, both included.
+type VlanRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// AnnouncePolicySpec selects VMI interfaces and says how they are announced.
+// An interface is selected when it matches every selector set; a policy
+// without selectors selects every interface.
+type AnnouncePolicySpec struct {
+	// Vlans of the interfaces selected
+	Vlans *VlanRange `json:"vlans,omitempty"`
+	// Names of the IPPools the addresses of the interfaces selected are from
+	IPPools []string `json:"ipPools,omitempty"`
+	// Label selector of the namespaces of the VMIs selected
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	// Whether the interfaces selected are announced, true when unset
+	Enabled *bool `json:"enabled,omitempty"`
+	// Announcers to announce with, in order, those of the configuration
+	// when empty
+	Announcers []string `json:"announcers,omitempty"`
+	// Times each frame is written, the announcer's own count when 0
+	Burst int `json:"burst,omitempty"`
+	// Time between the writes of a burst, rarpInterval when unset
+	Interval *metav1.Duration `json:"interval,omitempty"`
+	// Interfaces of higher priority are announced first in a round
+	Priority int `json:"priority,omitempty"`
+}
+
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AnnouncePolicy tells the agents how to announce the VMI interfaces it
+// selects. Of the policies selecting an interface, the most specific applies.
+type AnnouncePolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec AnnouncePolicySpec `json:"spec,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AnnouncePolicyList contains a list of AnnouncePolicy
+type AnnouncePolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AnnouncePolicy `json:"items"`
+}
@@ -0,0 +1,85 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// AnnounceRequestSpec selects the VMIs to announce again. A VMI is selected
+// when it lives in the request's namespace and matches both VMIs and
+// Selector; leaving VMIs and Selector empty selects every VMI of the
+// namespace. A request cannot reach the VMIs of another namespace.
+type AnnounceRequestSpec struct {
+	// Names of the VMIs to announce
+	VMIs []string `json:"vmis,omitempty"`
+	// Label selector of the VMIs to announce
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+	// Namespaces to select VMIs from, which may only name the request's own
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Nodes whose agents act on the request, all when empty
+	NodeNames []string `json:"nodeNames,omitempty"`
+}
+
+// NodeAnnounceResult is what one node's agent did for a request.
+type NodeAnnounceResult struct {
+	// The node the agent runs on
+	Node string `json:"node"`
+	// The generation of the request the round was run for
+	ObservedGeneration int64 `json:"observedGeneration"`
+	// When the round finished
+	Time metav1.Time `json:"time"`
+	// Succeeded, PartiallyFailed, Failed, NothingToAnnounce or DryRun
+	Result string `json:"result"`
+	// The VMIs announced, as namespace/name
+	VMIs []string `json:"vmis,omitempty"`
+	// Number of frames written and failed
+	FramesSent   int `json:"framesSent"`
+	FramesFailed int `json:"framesFailed"`
+	// Errors met during the round
+	Errors []string `json:"errors,omitempty"`
+	// What each announcer sent
+	Announcers []AnnouncerResult `json:"announcers,omitempty"`
+}
+
+// AnnounceRequestStatus collects the results of the nodes that acted.
+type AnnounceRequestStatus struct {
+	// One entry per node, each written by that node's agent
+	Nodes []NodeAnnounceResult `json:"nodes,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AnnounceRequest asks the agents to announce the selected VMIs once for
+// every generation of the request.
+type AnnounceRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AnnounceRequestSpec   `json:"spec,omitempty"`
+	Status AnnounceRequestStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// AnnounceRequestList contains a list of AnnounceRequest
+type AnnounceRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AnnounceRequest `json:"items"`
+}
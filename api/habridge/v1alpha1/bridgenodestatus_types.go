@@ -0,0 +1,142 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BondStatus is the state of a monitored bond.
+type BondStatus struct {
+	// Name of the bond device
+	Name string `json:"name"`
+	// Bonding mode as reported by the driver, such as active-backup
+	Mode string `json:"mode,omitempty"`
+	// Slaves enslaved to the bond
+	Slaves []string `json:"slaves,omitempty"`
+	// The slave currently carrying the traffic
+	ActiveSlave string `json:"activeSlave,omitempty"`
+	// Whether the bond has carrier
+	Carrier bool `json:"carrier"`
+}
+
+// BridgeStatus is a vlan bridge found on the node.
+type BridgeStatus struct {
+	// Name of the bridge device
+	Name string `json:"name"`
+	// The vlan the bridge carries, taken from its name
+	Vlan int `json:"vlan"`
+	// Devices attached to the bridge
+	LowerDevices []string `json:"lowerDevices,omitempty"`
+}
+
+// FailoverRound records one announcement round.
+type FailoverRound struct {
+	// When the round was triggered
+	Time metav1.Time `json:"time"`
+	// How long the round took
+	Duration metav1.Duration `json:"duration"`
+	// What triggered the round, such as netlink
+	Trigger string `json:"trigger"`
+	// The bond whose failover triggered the round
+	Bond string `json:"bond,omitempty"`
+	// The active slave of the bond before and after the failover
+	OldSlave string `json:"oldSlave,omitempty"`
+	NewSlave string `json:"newSlave,omitempty"`
+	// The vlan the round was scoped to, as when its gateway moved
+	Vlan int `json:"vlan,omitempty"`
+	// Succeeded, PartiallyFailed, Failed, NothingToAnnounce or DryRun
+	Result string `json:"result"`
+	// The VMIs announced, as namespace/name
+	VMIs []string `json:"vmis,omitempty"`
+	// Number of frames written and failed
+	FramesSent   int `json:"framesSent"`
+	FramesFailed int `json:"framesFailed"`
+	// Errors met during the round
+	Errors []string `json:"errors,omitempty"`
+	// Whether the informers had not synced and the round announced the VMIs
+	// of the local checkpoint
+	FromCheckpoint bool `json:"fromCheckpoint,omitempty"`
+	// Whether there was no checkpoint either and the round announced what
+	// discovery found on the bridges
+	FromDiscovery bool `json:"fromDiscovery,omitempty"`
+	// What each announcer sent
+	Announcers []AnnouncerResult `json:"announcers,omitempty"`
+	// The gateway checks of the vlans announced on
+	Gateways []GatewayCheck `json:"gateways,omitempty"`
+	// The VMIs that sent no unicast packets after the round and its
+	// re-announcements, as namespace/name
+	Unrecovered []string `json:"unrecovered,omitempty"`
+}
+
+// GatewayCheck is whether the gateway of a vlan replied through the active
+// slave after a round.
+type GatewayCheck struct {
+	Vlan int `json:"vlan"`
+	// The bridge the gateway was asked from
+	Bridge  string `json:"bridge"`
+	Gateway string `json:"gateway"`
+	// The active slave the reply was expected on
+	Slave string `json:"slave,omitempty"`
+	// Whether the reply arrived on the slave
+	Reachable bool `json:"reachable"`
+	// Why the gateway could not be checked
+	Error string `json:"error,omitempty"`
+}
+
+// AnnouncerResult is what one announcer sent in a round.
+type AnnouncerResult struct {
+	// The announcer, such as garp-request
+	Name string `json:"name"`
+	// Number of frames, bursts or commands sent and failed
+	Sent   int `json:"sent"`
+	Failed int `json:"failed"`
+}
+
+// BridgeNodeStatusStatus is what the agent sees on its node.
+type BridgeNodeStatusStatus struct {
+	// The monitored bonds
+	Bonds []BondStatus `json:"bonds,omitempty"`
+	// The vlan bridges found on the node
+	Bridges []BridgeStatus `json:"bridges,omitempty"`
+	// The last failover rounds, most recent first
+	Rounds []FailoverRound `json:"rounds,omitempty"`
+	// When the agent last wrote the status
+	LastUpdateTime metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// +genclient
+// +genclient:noStatus
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// BridgeNodeStatus is written by the agent of the node it is named after.
+type BridgeNodeStatus struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status BridgeNodeStatusStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// BridgeNodeStatusList contains a list of BridgeNodeStatus
+type BridgeNodeStatusList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BridgeNodeStatus `json:"items"`
+}
@@ -4,6 +4,7 @@
 # libpcap-devel
 export CGO_ENABLED="1"
 go build -o habridge ./cmd/
+go build -o habridgectl ./cmd/habridgectl/
 md5sum habridge
 docker build -t 192.168.29.235:30443/k8s-deploy/habridge:v1.5 .
 docker save -o habridge.tar 192.168.29.235:30443/k8s-deploy/habridge:v1.5
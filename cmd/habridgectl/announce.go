@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"ha-bridge/api/habridge/v1alpha1"
+	"io"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"os"
+	"strings"
+	"time"
+)
+
+// pollInterval is how often announce --wait reads the request back.
+const pollInterval = time.Second
+
+func runAnnounce(args []string) error {
+	fs := newFlagSet("announce")
+	o := newOptions(fs)
+	output := addOutputFlag(fs)
+	nodes := fs.StringSlice("node", nil, "only the agents of these nodes announce, by default all of them")
+	timeout := fs.Duration("wait", 0, "how long to wait for the agents to report, 0 to return once the request is created")
+	if err := parse(fs, o.goflags, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one namespace/vmi")
+	}
+	c, err := o.complete()
+	if err != nil {
+		return err
+	}
+	defaultNamespace, _, err := o.clientConfig.Namespace()
+	if err != nil {
+		return err
+	}
+	namespace, name, err := splitKey(fs.Arg(0), defaultNamespace)
+	if err != nil {
+		return err
+	}
+	// wait for the node running the vmi when the request goes to all nodes
+	waitFor := *nodes
+	if len(waitFor) == 0 && *timeout > 0 {
+		vmi, err := c.virt.VirtualMachineInstance(namespace).Get(name, &metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("get vmi %s/%s: %v", namespace, name, err)
+		}
+		if vmi.Status.NodeName == "" {
+			return fmt.Errorf("vmi %s/%s is not scheduled", namespace, name)
+		}
+		waitFor = []string{vmi.Status.NodeName}
+	}
+
+	requests := c.habridge.HabridgeV1alpha1().AnnounceRequests(namespace)
+	req, err := requests.Create(&v1alpha1.AnnounceRequest{
+		ObjectMeta: metav1.ObjectMeta{GenerateName: name + "-", Namespace: namespace},
+		Spec:       v1alpha1.AnnounceRequestSpec{VMIs: []string{name}, NodeNames: *nodes},
+	})
+	if err != nil {
+		return fmt.Errorf("create AnnounceRequest: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "announcerequest %s/%s created\n", req.Namespace, req.Name)
+	if *timeout == 0 {
+		return nil
+	}
+
+	err = wait.PollImmediate(pollInterval, *timeout, func() (bool, error) {
+		latest, err := requests.Get(req.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		req = latest
+		return reported(req, waitFor), nil
+	})
+	if err != nil && err != wait.ErrWaitTimeout {
+		return err
+	}
+	if perr := printObject(os.Stdout, *output, req.Status.Nodes, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tRESULT\tVMIS\tSENT\tFAILED\tERRORS")
+		for _, n := range req.Status.Nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", n.Node, n.Result, orNone(strings.Join(n.VMIs, ",")),
+				n.FramesSent, n.FramesFailed, strings.Join(n.Errors, "; "))
+		}
+	}); perr != nil {
+		return perr
+	}
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("timed out waiting for %s to report", strings.Join(waitFor, ", "))
+	}
+	for _, n := range req.Status.Nodes {
+		if n.Result == "Failed" || n.Result == "PartiallyFailed" {
+			return errFindings
+		}
+	}
+	return nil
+}
+
+// reported tells whether every node of nodes reported on the current
+// generation of req.
+func reported(req *v1alpha1.AnnounceRequest, nodes []string) bool {
+	for _, node := range nodes {
+		done := false
+		for _, n := range req.Status.Nodes {
+			if n.Node == node && n.ObservedGeneration >= req.Generation {
+				done = true
+			}
+		}
+		if !done {
+			return false
+		}
+	}
+	return true
+}
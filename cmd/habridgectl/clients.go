@@ -0,0 +1,125 @@
+package main
+
+import (
+	ipfixedclientset "cmos.chinamobile.com/ip-fixed/generated/ipfixed/clientset/versioned"
+	ipaminformers "cmos.chinamobile.com/ip-fixed/generated/ipfixed/informers/externalversions"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/spf13/pflag"
+	habridgeclientset "ha-bridge/generated/habridge/clientset/versioned"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/ipam"
+	"io"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"kubevirt.io/client-go/kubecli"
+	"sigs.k8s.io/yaml"
+	"text/tabwriter"
+	"time"
+)
+
+// syncTimeout bounds the wait for the ipfixed caches.
+const syncTimeout = time.Minute
+
+// options are the flags every subcommand shares: how to reach the cluster,
+// and the agent configuration the answers are computed under, which should
+// be the one the agents run with.
+type options struct {
+	clientConfig clientcmd.ClientConfig
+	goflags      *flag.FlagSet
+	loader       *config.Loader
+}
+
+func newOptions(fs *pflag.FlagSet) *options {
+	o := &options{
+		clientConfig: kubecli.DefaultClientConfig(fs),
+		goflags:      flag.NewFlagSet("habridge", flag.ContinueOnError),
+	}
+	o.loader = config.NewLoader(o.goflags)
+	fs.AddGoFlagSet(o.goflags)
+	return o
+}
+
+// clients are the API clients of the subcommands.
+type clients struct {
+	virt     kubecli.KubevirtClient
+	ipfixed  ipfixedclientset.Interface
+	habridge habridgeclientset.Interface
+}
+
+// complete loads and installs the agent configuration and builds the
+// clients.
+func (o *options) complete() (*clients, error) {
+	cfg, err := o.loader.Load()
+	if err != nil {
+		return nil, err
+	}
+	config.Set(cfg)
+	restConfig, err := o.clientConfig.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	c := &clients{}
+	// the kubevirt client rewrites the config it is given
+	if c.virt, err = kubecli.GetKubevirtClientFromRESTConfig(rest.CopyConfig(restConfig)); err != nil {
+		return nil, fmt.Errorf("cannot obtain KubeVirt client: %v", err)
+	}
+	if c.ipfixed, err = ipfixedclientset.NewForConfig(restConfig); err != nil {
+		return nil, fmt.Errorf("cannot obtain Ipam client: %v", err)
+	}
+	if c.habridge, err = habridgeclientset.NewForConfig(restConfig); err != nil {
+		return nil, fmt.Errorf("cannot obtain habridge client: %v", err)
+	}
+	return c, nil
+}
+
+// syncIPAM fills the ipam caches the agents resolve addresses with.
+func (c *clients) syncIPAM() error {
+	factory := ipaminformers.NewSharedInformerFactory(c.ipfixed, 0)
+	recorders := factory.Ipfixed().V1alpha1().IPRecorders().Informer()
+	recorders.AddIndexers(cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	pools := factory.Ipfixed().V1alpha1().IPPools().Informer()
+	pools.AddEventHandler(ipam.PoolEventHandler)
+	stop := make(chan struct{})
+	timer := time.AfterFunc(syncTimeout, func() { close(stop) })
+	factory.Start(stop)
+	if !cache.WaitForCacheSync(stop, recorders.HasSynced, pools.HasSynced) {
+		return fmt.Errorf("timed out waiting for the ipfixed caches to sync")
+	}
+	timer.Stop()
+	ipam.RecorderInformer = recorders
+	ipam.PoolInformer = pools
+	return nil
+}
+
+// addOutputFlag registers the -o flag of the subcommands printing objects.
+func addOutputFlag(fs *pflag.FlagSet) *string {
+	return fs.StringP("output", "o", "table", "output format: table, json or yaml")
+}
+
+// printObject writes obj to w in format, using table for the table format.
+func printObject(w io.Writer, format string, obj interface{}, table func(w io.Writer)) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	case "json":
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
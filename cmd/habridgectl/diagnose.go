@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/plan"
+	"io"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubev1 "kubevirt.io/client-go/api/v1"
+	"os"
+	"time"
+)
+
+// Severities of the findings.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// Areas the findings are about.
+const (
+	areaAgent  = "agent"
+	areaBond   = "bond"
+	areaBridge = "bridge"
+	areaIPAM   = "ipam"
+)
+
+// staleRefreshes is how many status refresh periods may pass without a
+// write before the agent is reported as not writing its status.
+const staleRefreshes = 3
+
+// finding is an inconsistency diagnose found on the node.
+type finding struct {
+	Severity string `json:"severity"`
+	Area     string `json:"area"`
+	Message  string `json:"message"`
+}
+
+func runDiagnose(args []string) error {
+	fs := newFlagSet("diagnose")
+	o := newOptions(fs)
+	output := addOutputFlag(fs)
+	if err := parse(fs, o.goflags, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one node")
+	}
+	node := fs.Arg(0)
+	c, err := o.complete()
+	if err != nil {
+		return err
+	}
+	status, err := c.habridge.HabridgeV1alpha1().BridgeNodeStatuses().Get(node, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		status = nil
+	} else if err != nil {
+		return fmt.Errorf("get BridgeNodeStatus %s: %v", node, err)
+	}
+	vmis, err := listNodeVMIs(c.virt, node)
+	if err != nil {
+		return err
+	}
+	local, _ := plan.Select(vmis, node)
+	if err := c.syncIPAM(); err != nil {
+		return err
+	}
+	findings := diagnose(config.Get(), node, status, local, time.Now())
+	if err := printObject(os.Stdout, *output, findings, func(w io.Writer) {
+		if len(findings) == 0 {
+			fmt.Fprintf(w, "no inconsistencies found on %s\n", node)
+			return
+		}
+		fmt.Fprintln(w, "SEVERITY\tAREA\tMESSAGE")
+		for _, f := range findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", f.Severity, f.Area, f.Message)
+		}
+	}); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		if f.Severity == severityError {
+			return errFindings
+		}
+	}
+	return nil
+}
+
+// diagnose checks what the agent of node reported in status against cfg,
+// and the addresses of the VMIs running there against the IPAM caches. A
+// nil status means the agent never reported.
+func diagnose(cfg *config.Config, node string, status *v1alpha1.BridgeNodeStatus, vmis []kubev1.VirtualMachineInstance, now time.Time) []finding {
+	var findings []finding
+	report := func(severity, area, format string, args ...interface{}) {
+		findings = append(findings, finding{Severity: severity, Area: area, Message: fmt.Sprintf(format, args...)})
+	}
+
+	bridges := map[string]*v1alpha1.BridgeStatus{}
+	if status == nil {
+		report(severityError, areaAgent, "no BridgeNodeStatus for %s, the agent is not running there or cannot write its status", node)
+	} else {
+		if age := now.Sub(status.Status.LastUpdateTime.Time); age > staleRefreshes*cfg.StatusRefreshPeriod.Duration {
+			report(severityWarning, areaAgent, "status last written %s ago", age.Round(time.Second))
+		}
+		diagnoseBonds(cfg, status.Status.Bonds, report)
+		for i := range status.Status.Bridges {
+			bridges[status.Status.Bridges[i].Name] = &status.Status.Bridges[i]
+		}
+		if rounds := status.Status.Rounds; len(rounds) > 0 && (rounds[0].Result == "Failed" || rounds[0].Result == "PartiallyFailed") {
+			round := rounds[0]
+			report(severityWarning, areaAgent, "last round at %s triggered by %s %s: %d frames failed, %d errors",
+				round.Time.Format(time.RFC3339), round.Trigger, round.Result, round.FramesFailed, len(round.Errors))
+		}
+	}
+
+	for i := range vmis {
+		vmi := &vmis[i]
+		for _, intf := range vmi.Status.Interfaces {
+			if !cfg.AnnounceInterface(intf.InterfaceName) {
+				continue
+			}
+			where := fmt.Sprintf("%s/%s interface %s", vmi.Namespace, vmi.Name, orNone(intf.InterfaceName))
+			entry, bridge, err := ipam.CheckInterface(cfg, intf)
+			if err != nil {
+				report(severityError, areaIPAM, "%s: %v", where, err)
+				continue
+			}
+			if entry.Namespace != vmi.Namespace || entry.Name != vmi.Name {
+				report(severityError, areaIPAM, "%s: ip %s is recorded for %s/%s", where, intf.IP, entry.Namespace, entry.Name)
+			}
+			if pool, err := ipam.GetPool(intf.IP); err != nil {
+				report(severityWarning, areaIPAM, "%s: %v", where, err)
+			} else if pool.Spec.Vlan != entry.Vlan {
+				report(severityError, areaIPAM, "%s: ip %s is recorded on vlan %d but ippool %s is vlan %d",
+					where, intf.IP, entry.Vlan, pool.Name, pool.Spec.Vlan)
+			}
+			if status == nil {
+				continue
+			}
+			switch b, ok := bridges[bridge]; {
+			case !ok:
+				report(severityError, areaBridge, "%s: bridge %s does not exist", where, bridge)
+			case len(b.LowerDevices) == 0:
+				report(severityError, areaBridge, "%s: bridge %s has no devices attached", where, bridge)
+			}
+		}
+	}
+	return findings
+}
+
+func diagnoseBonds(cfg *config.Config, bonds []v1alpha1.BondStatus, report func(severity, area, format string, args ...interface{})) {
+	byName := map[string]v1alpha1.BondStatus{}
+	for _, bond := range bonds {
+		byName[bond.Name] = bond
+	}
+	for _, name := range cfg.Bonds {
+		bond, ok := byName[name]
+		switch {
+		case !ok || bond.Mode == "":
+			report(severityError, areaBond, "bond %s does not exist", name)
+		case bond.Mode != "active-backup":
+			report(severityError, areaBond, "bond %s is in mode %s, not active-backup", name, bond.Mode)
+		case !bond.Carrier:
+			report(severityError, areaBond, "bond %s has no carrier", name)
+		case bond.ActiveSlave == "":
+			report(severityError, areaBond, "bond %s has no active slave", name)
+		case len(bond.Slaves) < 2:
+			report(severityWarning, areaBond, "bond %s has no standby slave to fail over to", name)
+		}
+	}
+}
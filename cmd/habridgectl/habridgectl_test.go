@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/plan"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	kubev1 "kubevirt.io/client-go/api/v1"
+)
+
+// setupIPAM fills the ipam caches with recorders and pools.
+func setupIPAM(recorders []*v2.IPRecorder, pools []*v2.IPPool) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	for _, r := range recorders {
+		informer.GetIndexer().Add(r)
+	}
+	ipam.RecorderInformer = informer
+	for _, p := range pools {
+		ipam.PoolEventHandler.OnAdd(p)
+	}
+}
+
+func newVMI(name string, phase kubev1.VirtualMachineInstancePhase, interfaces ...kubev1.VirtualMachineInstanceNetworkInterface) kubev1.VirtualMachineInstance {
+	vmi := kubev1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name = "default", name
+	vmi.Status.NodeName, vmi.Status.Phase, vmi.Status.Interfaces = "node-a", phase, interfaces
+	return vmi
+}
+
+func newPool(name, cidr string, vlan int) *v2.IPPool {
+	pool := &v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	pool.Spec.Cidr, pool.Spec.Vlan = cidr, vlan
+	return pool
+}
+
+func TestInventory(t *testing.T) {
+	setupIPAM([]*v2.IPRecorder{{
+		ObjectMeta: metav1.ObjectMeta{Name: "r"},
+		IPLists:    []v2.IPRecorderIPLists{{IPAddress: "10.0.0.2", Vlan: 100, Namespace: "default", Name: "vm1"}},
+	}}, nil)
+	entries := inventory(config.Default(), []kubev1.VirtualMachineInstance{
+		newVMI("vm2", kubev1.Scheduled, kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.0.2"}),
+		newVMI("vm1", kubev1.Running,
+			kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.0.2", MAC: "02:00:00:00:00:01"},
+			kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth1", IP: "10.0.1.2"}),
+	})
+	if len(entries) != 3 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if e := entries[0]; e.VMI != "vm1" || !e.Announceable || e.Vlan != 100 || e.Bridge != "vlan100" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e := entries[1]; e.Announceable || !strings.Contains(e.Reason, "not announced") {
+		t.Errorf("eth1 should not be announced: %+v", e)
+	}
+	if e := entries[2]; e.Announceable || e.Reason != "vmi is Scheduled" || e.Bridge != "vlan100" {
+		t.Errorf("a vmi not running should not be announced: %+v", e)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	setupIPAM([]*v2.IPRecorder{{
+		ObjectMeta: metav1.ObjectMeta{Name: "r"},
+		IPLists: []v2.IPRecorderIPLists{
+			{IPAddress: "10.0.0.2", Vlan: 100, Namespace: "default", Name: "vm1"},
+			{IPAddress: "10.0.0.3", Vlan: 100, Namespace: "default", Name: "other"},
+			{IPAddress: "10.0.2.2", Vlan: 102, Namespace: "default", Name: "vm4"},
+		},
+	}}, []*v2.IPPool{newPool("p100", "10.0.0.0/24", 100), newPool("p102", "10.0.2.0/24", 202)})
+	now := time.Now()
+	status := &v1alpha1.BridgeNodeStatus{Status: v1alpha1.BridgeNodeStatusStatus{
+		Bonds:          []v1alpha1.BondStatus{{Name: "bond0", Mode: "active-backup", Slaves: []string{"eth0"}, ActiveSlave: "eth0", Carrier: true}},
+		Bridges:        []v1alpha1.BridgeStatus{{Name: "vlan100", Vlan: 100, LowerDevices: []string{"bond0.100"}}},
+		LastUpdateTime: metav1.NewTime(now),
+	}}
+	vmis := []kubev1.VirtualMachineInstance{
+		newVMI("vm1", kubev1.Running, kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.0.2"}),
+		newVMI("vm2", kubev1.Running, kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.0.3"}),
+		newVMI("vm3", kubev1.Running, kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0"}),
+		newVMI("vm4", kubev1.Running, kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.2.2"}),
+	}
+	findings := diagnose(config.Default(), "node-a", status, vmis, now)
+	want := []string{
+		"warning bond bond bond0 has no standby slave",
+		"error ipam default/vm2 interface eth0: ip 10.0.0.3 is recorded for default/other",
+		"error ipam default/vm3 interface eth0: interface \"eth0\" has no ip address",
+		"error ipam default/vm4 interface eth0: ip 10.0.2.2 is recorded on vlan 102 but ippool p102 is vlan 202",
+		"error bridge default/vm4 interface eth0: bridge vlan102 does not exist",
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("unexpected findings %+v", findings)
+	}
+	for i, f := range findings {
+		if got := f.Severity + " " + f.Area + " " + f.Message; !strings.HasPrefix(got, want[i]) {
+			t.Errorf("finding %d: got %q, want %q", i, got, want[i])
+		}
+	}
+
+	findings = diagnose(config.Default(), "node-a", nil, nil, now)
+	if len(findings) != 1 || findings[0].Area != areaAgent || findings[0].Severity != severityError {
+		t.Errorf("a missing status should be reported: %+v", findings)
+	}
+}
+
+func TestSplitKey(t *testing.T) {
+	if ns, name, err := splitKey("vm1", "default"); err != nil || ns != "default" || name != "vm1" {
+		t.Errorf("got %s %s %v", ns, name, err)
+	}
+	if ns, name, err := splitKey("prod/vm1", "default"); err != nil || ns != "prod" || name != "vm1" {
+		t.Errorf("got %s %s %v", ns, name, err)
+	}
+	for _, bad := range []string{"", "/vm1", "a/b/c"} {
+		if _, _, err := splitKey(bad, "default"); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	pool := newPool("pool-a", "10.0.0.0/24", 100)
+	setupIPAM([]*v2.IPRecorder{{
+		ObjectMeta: metav1.ObjectMeta{Name: "r"},
+		IPLists:    []v2.IPRecorderIPLists{{IPAddress: "10.0.0.2", Vlan: 100, Pool: "pool-a", Namespace: "default", Name: "vm1"}},
+	}}, []*v2.IPPool{pool})
+	defer ipam.PoolEventHandler.OnDelete(pool)
+	away := newVMI("vm2", kubev1.Running, kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.0.3"})
+	away.UID, away.Status.NodeName = "vm2", "node-b"
+	vmi := newVMI("vm1", kubev1.Running,
+		kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.0.2", IPs: []string{"10.0.0.2"}, MAC: "02:00:00:00:00:01"},
+		kubev1.VirtualMachineInstanceNetworkInterface{InterfaceName: "eth0", IP: "10.0.5.5", IPs: []string{"10.0.5.5"}, MAC: "02:00:00:00:00:02"})
+	vmi.UID = "vm1"
+
+	sim := simulate(config.Default(), "node-a", "bond0", []kubev1.VirtualMachineInstance{vmi, away, vmi})
+	if sim.VMIs != 1 || len(sim.Frames) != 2 || sim.Frames[0].Bridge != "vlan100" ||
+		sim.Frames[1].Kind != config.AnnouncerRARP || sim.Frames[1].Count != config.Default().RARPBurst {
+		t.Errorf("unexpected frames %+v", sim.Frames)
+	}
+	if len(sim.Skipped) != 2 || sim.Skipped[0].Reason != plan.ReasonNotLocal || sim.Skipped[1].Reason != plan.ReasonAddressNotRecorded {
+		t.Errorf("unexpected skips %+v", sim.Skipped)
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/ipam"
+	"io"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubev1 "kubevirt.io/client-go/api/v1"
+	"os"
+	"sort"
+	"strings"
+)
+
+// inventoryEntry is one guest interface of a VMI, as the agent of its node
+// would announce it.
+type inventoryEntry struct {
+	Node         string   `json:"node"`
+	Namespace    string   `json:"namespace"`
+	VMI          string   `json:"vmi"`
+	Interface    string   `json:"interface"`
+	MAC          string   `json:"mac"`
+	IPs          []string `json:"ips"`
+	Vlan         int      `json:"vlan,omitempty"`
+	Bridge       string   `json:"bridge,omitempty"`
+	Announceable bool     `json:"announceable"`
+	// Reason says why the interface is not announced.
+	Reason string `json:"reason,omitempty"`
+}
+
+func runInventory(args []string) error {
+	fs := newFlagSet("inventory")
+	o := newOptions(fs)
+	output := addOutputFlag(fs)
+	node := fs.String("node", "", "only list the VMIs of this node")
+	if err := parse(fs, o.goflags, args); err != nil {
+		return err
+	}
+	c, err := o.complete()
+	if err != nil {
+		return err
+	}
+	namespace, explicit, err := o.clientConfig.Namespace()
+	if err != nil {
+		return err
+	}
+	// unlike kubectl, list all namespaces unless one is asked for
+	if !explicit {
+		namespace = k8sv1.NamespaceAll
+	}
+	options := &metav1.ListOptions{}
+	if *node != "" {
+		options.LabelSelector = kubev1.NodeNameLabel + "=" + *node
+	}
+	vmis, err := c.virt.VirtualMachineInstance(namespace).List(options)
+	if err != nil {
+		return fmt.Errorf("list vmis: %v", err)
+	}
+	if err := c.syncIPAM(); err != nil {
+		return err
+	}
+	entries := inventory(config.Get(), vmis.Items)
+	return printObject(os.Stdout, *output, entries, func(w io.Writer) {
+		fmt.Fprintln(w, "NODE\tNAMESPACE\tVMI\tINTERFACE\tMAC\tIPS\tVLAN\tBRIDGE\tANNOUNCEABLE\tREASON")
+		for _, e := range entries {
+			vlan := "-"
+			if e.Vlan != 0 {
+				vlan = fmt.Sprint(e.Vlan)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%v\t%s\n", orNone(e.Node), e.Namespace, e.VMI, orNone(e.Interface),
+				orNone(e.MAC), orNone(strings.Join(e.IPs, ",")), vlan, orNone(e.Bridge), e.Announceable, e.Reason)
+		}
+	})
+}
+
+// inventory resolves every interface of vmis under cfg, sorted by node.
+func inventory(cfg *config.Config, vmis []kubev1.VirtualMachineInstance) []inventoryEntry {
+	var entries []inventoryEntry
+	for i := range vmis {
+		vmi := &vmis[i]
+		for _, intf := range vmi.Status.Interfaces {
+			e := inventoryEntry{
+				Node:      vmi.Status.NodeName,
+				Namespace: vmi.Namespace,
+				VMI:       vmi.Name,
+				Interface: intf.InterfaceName,
+				MAC:       intf.MAC,
+				IPs:       intf.IPs,
+			}
+			entry, bridge, err := ipam.CheckInterface(cfg, intf)
+			if entry != nil {
+				e.Vlan, e.Bridge = entry.Vlan, bridge
+			}
+			switch {
+			case err != nil:
+				e.Reason = err.Error()
+			case vmi.Status.Phase != kubev1.Running:
+				e.Reason = fmt.Sprintf("vmi is %s", orNone(string(vmi.Status.Phase)))
+			default:
+				e.Announceable = true
+			}
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.VMI < b.VMI
+	})
+	return entries
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,104 @@
+// habridgectl inspects the habridge agents and the addresses they announce,
+// and asks them for announcements, from anywhere with access to the cluster.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// command is a habridgectl subcommand.
+type command struct {
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	// filled in init as the commands look their usage up here
+	commands = map[string]command{
+		"inventory":         {"inventory [flags]", "list the VMI interfaces of every node and whether they are announced", runInventory},
+		"diagnose":          {"diagnose <node> [flags]", "report bond, bridge and IPAM inconsistencies of a node", runDiagnose},
+		"announce":          {"announce <namespace/vmi> [flags]", "ask the agents to announce a VMI now", runAnnounce},
+		"simulate-failover": {"simulate-failover <node> [flags]", "list the frames a bond failover would send and what it would skip", runSimulate},
+	}
+}
+
+// errFindings makes habridgectl exit with status 1 without printing more
+// than the command already did.
+var errFindings = fmt.Errorf("findings reported")
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "habridgectl: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if err != errFindings {
+			fmt.Fprintf(os.Stderr, "habridgectl %s: %v\n", os.Args[1], err)
+		}
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: habridgectl <command> [flags]\n\ncommands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-34s %s\n", commands[name].usage, commands[name].summary)
+	}
+}
+
+// newFlagSet returns the flag set of the subcommand name.
+func newFlagSet(name string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: habridgectl %s\n\nflags:\n%s", commands[name].usage, fs.FlagUsages())
+	}
+	return fs
+}
+
+// parse parses args into fs and copies the agent configuration flags set on
+// the command line back into goflags, whose Visit only reports flags set
+// through it.
+func parse(fs *pflag.FlagSet, goflags *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	fs.Visit(func(f *pflag.Flag) {
+		if goflags.Lookup(f.Name) != nil && err == nil {
+			err = goflags.Set(f.Name, f.Value.String())
+		}
+	})
+	return err
+}
+
+// splitKey splits namespace/name, defaulting the namespace to namespace.
+func splitKey(key, namespace string) (string, string, error) {
+	parts := strings.Split(key, "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return namespace, parts[0], nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return parts[0], parts[1], nil
+	}
+	return "", "", fmt.Errorf("%q is not namespace/name", key)
+}
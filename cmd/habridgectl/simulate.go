@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"ha-bridge/pkg/announce"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/plan"
+	"io"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubev1 "kubevirt.io/client-go/api/v1"
+	"kubevirt.io/client-go/kubecli"
+	"os"
+)
+
+// simulation is the report of simulate-failover: the round the agent of
+// Node would run if Bond failed over now.
+type simulation struct {
+	Node string `json:"node"`
+	Bond string `json:"bond"`
+	// VMIs is how many VMIs the round would announce.
+	VMIs int `json:"vmis"`
+	plan.Plan
+}
+
+func runSimulate(args []string) error {
+	fs := newFlagSet("simulate-failover")
+	o := newOptions(fs)
+	output := addOutputFlag(fs)
+	bond := fs.String("bond", "", "the bond failing over, the first configured bond by default")
+	if err := parse(fs, o.goflags, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected exactly one node")
+	}
+	node := fs.Arg(0)
+	c, err := o.complete()
+	if err != nil {
+		return err
+	}
+	cfg := config.Get()
+	if *bond == "" {
+		*bond = cfg.Bonds[0]
+	} else if !cfg.IsBond(*bond) {
+		return fmt.Errorf("%s is not a monitored bond, a failover would not trigger a round", *bond)
+	}
+	vmis, err := listNodeVMIs(c.virt, node)
+	if err != nil {
+		return err
+	}
+	if err := c.syncIPAM(); err != nil {
+		return err
+	}
+	sim := simulate(cfg, node, *bond, vmis)
+	return printObject(os.Stdout, *output, sim, func(w io.Writer) {
+		fmt.Fprintf(w, "failover of %s on %s would announce %d vmi with %d frames\n\n", sim.Bond, sim.Node, sim.VMIs, len(sim.Frames))
+		fmt.Fprintln(w, "NAMESPACE\tVMI\tINTERFACE\tKIND\tIP\tMAC\tBRIDGE\tVLAN\tBYTES")
+		for _, f := range sim.Frames {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", f.Namespace, f.VMI, f.Interface, f.Kind, orNone(f.IP), f.MAC, f.Bridge, f.Vlan, len(f.Data))
+		}
+		if len(sim.Skipped) == 0 {
+			return
+		}
+		fmt.Fprintln(w, "\nSKIPPED\tVMI\tINTERFACE\tIP\tREASON\tMESSAGE")
+		for _, s := range sim.Skipped {
+			fmt.Fprintf(w, "\t%s/%s\t%s\t%s\t%s\t%s\n", s.Namespace, s.VMI, orNone(s.Interface), orNone(s.IP), s.Reason, s.Message)
+		}
+	})
+}
+
+// listNodeVMIs lists the VMIs labelled with node or being migrated onto it,
+// as the informers of its agent do.
+func listNodeVMIs(virt kubecli.KubevirtClient, node string) ([]kubev1.VirtualMachineInstance, error) {
+	var result []kubev1.VirtualMachineInstance
+	for _, label := range []string{kubev1.NodeNameLabel, kubev1.MigrationTargetNodeNameLabel} {
+		list, err := virt.VirtualMachineInstance(k8sv1.NamespaceAll).List(&metav1.ListOptions{LabelSelector: label + "=" + node})
+		if err != nil {
+			return nil, fmt.Errorf("list vmis: %v", err)
+		}
+		result = append(result, list.Items...)
+	}
+	return result, nil
+}
+
+// simulate runs the planning half of a failover round of node under cfg.
+func simulate(cfg *config.Config, node, bond string, vmis []kubev1.VirtualMachineInstance) *simulation {
+	selected, skipped := plan.Select(vmis, node)
+	sim := &simulation{Node: node, Bond: bond, VMIs: len(selected), Plan: plan.Plan{Frames: []plan.Frame{}, Skipped: skipped}}
+	for i := range selected {
+		// the fdb of node is out of reach, so the interfaces without ip
+		// addresses show as skipped
+		sim.Add(announce.Build(cfg, &selected[i], nil))
+	}
+	return sim
+}
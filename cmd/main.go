@@ -17,16 +17,30 @@ limitations under the License.
 package main
 
 import (
-	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
 	ipfixedclientset "cmos.chinamobile.com/ip-fixed/generated/ipfixed/clientset/versioned"
 	ipaminformers "cmos.chinamobile.com/ip-fixed/generated/ipfixed/informers/externalversions"
+	"context"
 	"flag"
 	"fmt"
+	habridgeclientset "ha-bridge/generated/habridge/clientset/versioned"
+	habridgeinformers "ha-bridge/generated/habridge/informers/externalversions"
+	"ha-bridge/pkg/announcerequest"
 	"ha-bridge/pkg/bond"
+	"ha-bridge/pkg/checkpoint"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/discovery"
+	"ha-bridge/pkg/events"
 	"ha-bridge/pkg/failover"
+	"ha-bridge/pkg/gateway"
+	"ha-bridge/pkg/health"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/metrics"
+	"ha-bridge/pkg/nodestatus"
+	"ha-bridge/pkg/policy"
 	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
-	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/klog/v2"
@@ -35,17 +49,43 @@ import (
 	"math/rand"
 	"os"
 	"os/signal"
+	"sort"
+	"strings"
 	"time"
 )
 
+// configPollInterval is how often the configuration file is checked for
+// changes, which is how ConfigMap updates reach the agent.
+const configPollInterval = 10 * time.Second
+
 func main() {
 	klog.Infoln("start habridge......")
 	klog.InitFlags(nil)
+	loader := config.NewLoader(flag.CommandLine)
 	flag.Parse()
+	cfg, err := loader.Load()
+	if err != nil {
+		klog.Fatal(err)
+	}
+	config.Set(cfg)
 	failover.HOST_NAME = os.Getenv("HOST_NAME")
+	if failover.HOST_NAME == "" {
+		klog.Fatal("HOST_NAME is not set")
+	}
 	klog.Infoln("get nodename ", failover.HOST_NAME)
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := SetupSignalHandler()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		klog.Infoln("shutting down habridge......")
+		cancel()
+	}()
+	reloadCh := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(reloadCh, reloadSignals...)
+	}
+	go loader.Watch(ctx, reloadCh, configPollInterval)
 	virtClientSet, err := kubecli.GetKubevirtClient()
 	if err != nil {
 		klog.Fatalf("cannot obtain KubeVirt client: %v\n", err)
@@ -59,33 +99,119 @@ func main() {
 		klog.Fatalf("cannot obtain Ipam client: %v\n", err)
 	}
 	//ipfixedClient.IpfixedV1alpha1()
+	habridgeClient, err := habridgeclientset.NewForConfig(kubeConfig)
+	if err != nil {
+		klog.Fatalf("cannot obtain habridge client: %v\n", err)
+	}
+	events.Start(ctx, virtClientSet.CoreV1(), failover.HOST_NAME, float32(cfg.EventQPS), cfg.EventBurst)
 
 	klog.Infoln("create informer......")
-	lw := cache.NewListWatchFromClient(virtClientSet.RestClient(), "virtualmachineinstances", k8sv1.NamespaceAll, fields.Everything())
-	kubvirtInformer := cache.NewSharedIndexInformer(lw, &kubev1.VirtualMachineInstance{}, resyncPeriod(12*time.Hour), cache.Indexers{
-		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
-		"node": func(obj interface{}) (strings []string, e error) {
-			return []string{obj.(*kubev1.VirtualMachineInstance).Status.NodeName}, nil
-		},
-	})
+	kubvirtInformer := newVMIInformer(virtClientSet.RestClient(), kubev1.NodeNameLabel, failover.HOST_NAME, cfg.VMIResyncPeriod.Duration)
+	migrationInformer := newVMIInformer(virtClientSet.RestClient(), kubev1.MigrationTargetNodeNameLabel, failover.HOST_NAME, cfg.VMIResyncPeriod.Duration)
 	failover.VirtInformer = kubvirtInformer
-	ipfixedInformerFactory := ipaminformers.NewSharedInformerFactory(ipfixedClient, time.Second*30)
+	failover.MigrationInformer = migrationInformer
+	ipfixedInformerFactory := ipaminformers.NewSharedInformerFactory(ipfixedClient, cfg.IPAMResyncPeriod.Duration)
 	ipamInformer := ipfixedInformerFactory.Ipfixed().V1alpha1().IPRecorders().Informer()
-	ipamInformer.AddIndexers(cache.Indexers{"ipaddress": func(obj interface{}) (strings []string, e error) {
-		return []string{obj.(*v2.IPRecorder).IPLists[0].IPAddress}, nil
-	},
-	})
+	ipamInformer.AddIndexers(cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	poolInformer := ipfixedInformerFactory.Ipfixed().V1alpha1().IPPools().Informer()
+	poolInformer.AddEventHandler(ipam.PoolEventHandler)
+	podInformer := newPodInformer(virtClientSet.CoreV1().RESTClient(), failover.HOST_NAME)
+	habridgeInformerFactory := habridgeinformers.NewSharedInformerFactory(habridgeClient, 0)
+	policyInformer := habridgeInformerFactory.Habridge().V1alpha1().AnnouncePolicies().Informer()
+	namespaceInformer := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(virtClientSet.CoreV1().RESTClient(), "namespaces", k8sv1.NamespaceAll, fields.Everything()),
+		&k8sv1.Namespace{}, 0, cache.Indexers{})
+	policy.PolicyInformer = policyInformer
+	policy.NamespaceInformer = namespaceInformer
+	requestController := announcerequest.NewController(habridgeClient.HabridgeV1alpha1(), habridgeInformerFactory.Habridge().V1alpha1().AnnounceRequests(), failover.HOST_NAME)
+	metrics.RegisterLocalVMIs(failover.LocalVMICount)
+	metrics.RegisterInformerSynced("vmi", kubvirtInformer.HasSynced)
+	metrics.RegisterInformerSynced("vmi-migration", migrationInformer.HasSynced)
+	metrics.RegisterInformerSynced("iprecorder", ipamInformer.HasSynced)
+	metrics.RegisterInformerSynced("ippool", poolInformer.HasSynced)
+	metrics.RegisterInformerSynced("pod", podInformer.HasSynced)
+	metrics.RegisterInformerSynced("announcepolicy", policyInformer.HasSynced)
+	metrics.RegisterInformerSynced("namespace", namespaceInformer.HasSynced)
+	go metrics.Serve(ctx, cfg.MetricsAddress)
+	health.Register("informers", func() error {
+		return informersSynced(map[string]cache.InformerSynced{
+			"vmi":            kubvirtInformer.HasSynced,
+			"vmi-migration":  migrationInformer.HasSynced,
+			"iprecorder":     ipamInformer.HasSynced,
+			"ippool":         poolInformer.HasSynced,
+			"pod":            podInformer.HasSynced,
+			"announcepolicy": policyInformer.HasSynced,
+			"namespace":      namespaceInformer.HasSynced,
+		})
+	}, 0)
+	go health.Serve(ctx, cfg.HealthAddress)
 	klog.Infoln("start  informer......")
 	go kubvirtInformer.Run(stopCh)
+	go migrationInformer.Run(stopCh)
 	go ipamInformer.Run(stopCh)
-	if !cache.WaitForCacheSync(stopCh, ipamInformer.HasSynced) {
-		runtime.HandleError(fmt.Errorf("Timed out waiting for ipam caches to sync"))
-		return
-	}
-	failover.IpamInformer = ipamInformer
+	go poolInformer.Run(stopCh)
+	go podInformer.Run(stopCh)
+	go namespaceInformer.Run(stopCh)
+	// rounds must not wait for the API server, which a switch failure may
+	// have cut off; until the informers sync they announce from the checkpoint
+	ipam.RecorderInformer = ipamInformer
+	ipam.PoolInformer = poolInformer
+	ipam.PodInformer = podInformer
+	go func() {
+		if cache.WaitForCacheSync(stopCh, ipamInformer.HasSynced, poolInformer.HasSynced, podInformer.HasSynced, kubvirtInformer.HasSynced, migrationInformer.HasSynced) {
+			klog.Infoln("informer caches synced")
+		}
+	}()
+	go checkpoint.Run(ctx, failover.Checkpoint)
+	go discovery.Run(ctx)
+	go gateway.Run(ctx)
+	statusWriter := nodestatus.NewWriter(habridgeClient.HabridgeV1alpha1().BridgeNodeStatuses(), failover.HOST_NAME)
+	failover.OnRound(statusWriter.RecordRound)
+	go statusWriter.Run(ctx)
+	go failover.Run(ctx)
+	habridgeInformerFactory.Start(stopCh)
+	go requestController.Run(ctx)
 	klog.Infoln("start netlink listener ......")
-	bond.Start()
+	bond.Start(ctx)
+	failover.Shutdown(config.Get().ShutdownTimeout.Duration)
+}
 
+// newVMIInformer list-watches only the VMIs whose label matches node, so each
+// agent caches the handful of VMIs on its own node instead of the cluster.
+func newVMIInformer(client cache.Getter, label, node string, resync time.Duration) cache.SharedIndexInformer {
+	selector := labels.SelectorFromSet(labels.Set{label: node}).String()
+	lw := cache.NewFilteredListWatchFromClient(client, "virtualmachineinstances", k8sv1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.LabelSelector = selector
+	})
+	return cache.NewSharedIndexInformer(lw, &kubev1.VirtualMachineInstance{}, resyncPeriod(resync), cache.Indexers{
+		cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+	})
+}
+
+// newPodInformer list-watches the virt-launcher pods of node, under which
+// IPAM records the addresses of standalone VMIs.
+func newPodInformer(client cache.Getter, node string) cache.SharedIndexInformer {
+	selector := labels.SelectorFromSet(labels.Set{kubev1.AppLabel: "virt-launcher"}).String()
+	lw := cache.NewFilteredListWatchFromClient(client, "pods", k8sv1.NamespaceAll, func(options *metav1.ListOptions) {
+		options.LabelSelector = selector
+		options.FieldSelector = fields.OneTermEqualSelector("spec.nodeName", node).String()
+	})
+	return cache.NewSharedIndexInformer(lw, &k8sv1.Pod{}, 0, cache.Indexers{})
+}
+
+// informersSynced names the informers that have not synced yet.
+func informersSynced(informers map[string]cache.InformerSynced) error {
+	var pending []string
+	for name, hasSynced := range informers {
+		if !hasSynced() {
+			pending = append(pending, name)
+		}
+	}
+	if len(pending) > 0 {
+		sort.Strings(pending)
+		return fmt.Errorf("informers not synced: %s", strings.Join(pending, ", "))
+	}
+	return nil
 }
 
 // resyncPeriod computes the time interval a shared informer waits before resyncing with the api server
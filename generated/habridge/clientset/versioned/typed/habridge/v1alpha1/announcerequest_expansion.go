@@ -0,0 +1,51 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"strconv"
+
+	v1alpha1 "ha-bridge/api/habridge/v1alpha1"
+)
+
+// The AnnounceRequestExpansion interface allows manually adding extra methods to the AnnounceRequestInterface.
+type AnnounceRequestExpansion interface {
+	ApplyStatus(announceRequest *v1alpha1.AnnounceRequest, fieldManager string, force bool) (*v1alpha1.AnnounceRequest, error)
+}
+
+// ApplyStatus server-side applies the status fields set in announceRequest
+// on behalf of fieldManager, taking them over from other managers when force
+// is set.
+func (c *announceRequests) ApplyStatus(announceRequest *v1alpha1.AnnounceRequest, fieldManager string, force bool) (result *v1alpha1.AnnounceRequest, err error) {
+	data, err := json.Marshal(announceRequest)
+	if err != nil {
+		return nil, err
+	}
+	result = &v1alpha1.AnnounceRequest{}
+	err = c.client.Patch(ApplyPatchType).
+		Namespace(c.ns).
+		Resource("announcerequests").
+		Name(announceRequest.Name).
+		SubResource("status").
+		Param("fieldManager", fieldManager).
+		Param("force", strconv.FormatBool(force)).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
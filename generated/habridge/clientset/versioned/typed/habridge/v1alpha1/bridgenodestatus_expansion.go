@@ -0,0 +1,53 @@
+/*
+
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"strconv"
+
+	v1alpha1 "ha-bridge/api/habridge/v1alpha1"
+	types "k8s.io/apimachinery/pkg/types"
+)
+
+// ApplyPatchType is the server-side apply patch type, which the vendored
+// apimachinery predates.
+const ApplyPatchType types.PatchType = "application/apply-patch+yaml"
+
+// The BridgeNodeStatusExpansion interface allows manually adding extra methods to the BridgeNodeStatusInterface.
+type BridgeNodeStatusExpansion interface {
+	Apply(bridgeNodeStatus *v1alpha1.BridgeNodeStatus, fieldManager string, force bool) (*v1alpha1.BridgeNodeStatus, error)
+}
+
+// Apply server-side applies the fields set in bridgeNodeStatus on behalf of
+// fieldManager, taking them over from other managers when force is set.
+func (c *bridgeNodeStatuses) Apply(bridgeNodeStatus *v1alpha1.BridgeNodeStatus, fieldManager string, force bool) (result *v1alpha1.BridgeNodeStatus, err error) {
+	data, err := json.Marshal(bridgeNodeStatus)
+	if err != nil {
+		return nil, err
+	}
+	result = &v1alpha1.BridgeNodeStatus{}
+	err = c.client.Patch(ApplyPatchType).
+		Resource("bridgenodestatuses").
+		Name(bridgeNodeStatus.Name).
+		Param("fieldManager", fieldManager).
+		Param("force", strconv.FormatBool(force)).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,27 @@
+#!/usr/bin/env bash
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+# corresponding to go mod init <module>
+MODULE=ha-bridge
+# api package
+APIS_PKG=api
+# generated output package
+OUTPUT_PKG=generated/habridge
+# group-version such as foo:v1alpha1
+GROUP=habridge
+VERSION=v1alpha1
+GROUP_VERSION=${GROUP}:${VERSION}
+
+SCRIPT_ROOT=$(dirname "${BASH_SOURCE[0]}")/..
+# code-generator is not vendored, point CODEGEN_PKG at a checkout matching
+# the vendored client-go
+CODEGEN_PKG=${CODEGEN_PKG:-$(cd "${SCRIPT_ROOT}"; ls -d -1 ./vendor/k8s.io/code-generator 2>/dev/null || echo ../code-generator)}
+
+bash "${CODEGEN_PKG}"/generate-groups.sh "deepcopy,client,informer,lister" \
+  ${MODULE}/${OUTPUT_PKG} ${MODULE}/${APIS_PKG} \
+  ${GROUP_VERSION} \
+  --go-header-file "${SCRIPT_ROOT}"/hack/boilerplate.go.txt \
+  --output-base "${SCRIPT_ROOT}/.."
@@ -0,0 +1,255 @@
+// Package announce holds the announcers, the ways a round tells the network
+// where a VMI interface now is, and turns the resolved interfaces of a round
+// into the frames of the announcers their policy picks.
+package announce
+
+import (
+	"context"
+	"fmt"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/garp"
+	"ha-bridge/pkg/plan"
+	"ha-bridge/pkg/policy"
+	v1 "kubevirt.io/client-go/api/v1"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Announcer announces a VMI interface from its resolved addressing.
+type Announcer interface {
+	// Name is the name policies pick the announcer by, and the kind of the
+	// frames it plans.
+	Name() string
+	// Plan returns the frames announcing t under cfg and what it cannot
+	// announce. The addresses of the families it does not announce are left
+	// out without a skip.
+	Plan(cfg *config.Config, t plan.Target) *plan.Plan
+	// Send writes a frame the announcer planned and returns how many times
+	// it was written.
+	Send(ctx context.Context, cfg *config.Config, frame plan.Frame) (int, error)
+}
+
+var (
+	mu         sync.RWMutex
+	announcers = map[string]Announcer{}
+)
+
+// Register makes a available to the policies, replacing any announcer of the
+// same name.
+func Register(a Announcer) {
+	mu.Lock()
+	defer mu.Unlock()
+	announcers[a.Name()] = a
+}
+
+// Get returns the announcer called name.
+func Get(name string) (Announcer, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	a, ok := announcers[name]
+	return a, ok
+}
+
+// Names returns the names of the registered announcers, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for name := range announcers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Link is a host link frames are written on.
+type Link interface {
+	garp.PacketWriter
+	Close()
+}
+
+// OpenLink opens a host link for writing. The agent sets it to open a pcap
+// handle.
+var OpenLink func(name string) (Link, error)
+
+// Build plans the announcements of the interfaces of vmi under cfg. lookup,
+// when not nil, places the interfaces without ip addresses.
+func Build(cfg *config.Config, vmi *v1.VirtualMachineInstance, lookup plan.BridgeLookup) *plan.Plan {
+	targets, skipped := plan.Resolve(cfg, vmi, lookup)
+	p := BuildTargets(cfg, targets)
+	p.Skipped = append(skipped, p.Skipped...)
+	return p
+}
+
+// BuildTargets plans the announcements of targets, each with the announcers
+// its policy picks in their order and the burst, interval and priority of
+// its AnnouncePolicy, which the annotations of its VMI override, down to a
+// policy disabling it. The frames of the whole VMI are planned once.
+func BuildTargets(cfg *config.Config, targets []plan.Target) *plan.Plan {
+	p := &plan.Plan{}
+	vmiFrames := map[string]bool{}
+	for _, t := range targets {
+		skip := func(ip, reason, format string, args ...interface{}) {
+			p.Skipped = append(p.Skipped, plan.Skip{Namespace: t.Namespace, VMI: t.VMI, Interface: t.Interface, IP: ip,
+				Reason: reason, Message: fmt.Sprintf(format, args...)})
+		}
+		if _, err := net.ParseMAC(t.MAC); err != nil {
+			skip("", plan.ReasonInvalidAddress, "interface %q: %v", t.Interface, err)
+			continue
+		}
+		var ips []string
+		for _, ip := range t.IPs {
+			if net.ParseIP(ip) == nil {
+				skip(ip, plan.ReasonInvalidAddress, "invalid ip %q", ip)
+				continue
+			}
+			ips = append(ips, ip)
+		}
+		t.IPs = ips
+
+		settings := policy.For(cfg, t)
+		if settings.Disabled && !t.Enabled {
+			skip("", plan.ReasonDisabled, "announcepolicy %s disables interface %q", settings.Policy, t.Interface)
+			continue
+		}
+		names := settings.Announcers
+		covered := map[string]bool{}
+		planned := false
+		for _, name := range names {
+			a, ok := Get(name)
+			if !ok {
+				skip("", plan.ReasonUnknownAnnouncer, "announcer %q is not available", name)
+				continue
+			}
+			tp := a.Plan(cfg, t)
+			for _, frame := range tp.Frames {
+				if frame.Interface == "" {
+					key := frame.Kind + "/" + frame.Namespace + "/" + frame.VMI
+					if vmiFrames[key] {
+						continue
+					}
+					vmiFrames[key] = true
+				}
+				if frame.Data != nil {
+					if settings.Burst > 0 {
+						frame.Count = settings.Burst
+					}
+					if settings.Interval > 0 {
+						frame.Interval = settings.Interval
+					}
+					if t.ExtraBursts > 0 {
+						frame.Count = burst(frame) * (1 + t.ExtraBursts)
+					}
+				}
+				frame.Priority = settings.Priority
+				if t.Priority != nil {
+					frame.Priority = *t.Priority
+				}
+				frame.Policy = settings.Policy
+				if frame.IP != "" {
+					frame.Gateway = t.Gateway
+				}
+				covered[frame.IP] = true
+				planned = true
+				p.Frames = append(p.Frames, frame)
+			}
+			for _, s := range tp.Skipped {
+				covered[s.IP] = true
+				planned = true
+				p.Skipped = append(p.Skipped, s)
+			}
+		}
+		for _, ip := range t.IPs {
+			if !covered[ip] {
+				skip(ip, plan.ReasonUnsupportedFamily, "none of the announcers %s announces ip %s", strings.Join(names, ", "), ip)
+			}
+		}
+		if !planned && len(t.IPs) == 0 {
+			skip("", plan.ReasonNoIPAddress, "interface %q has no ip address and none of the announcers %s announces its mac",
+				t.Interface, strings.Join(names, ", "))
+		}
+	}
+	return p
+}
+
+// Send has the announcer that planned frame send it.
+func Send(ctx context.Context, cfg *config.Config, frame plan.Frame) (int, error) {
+	a, ok := Get(frame.Kind)
+	if !ok {
+		return 0, fmt.Errorf("unknown announcer %q", frame.Kind)
+	}
+	return a.Send(ctx, cfg, frame)
+}
+
+// Family is the address family a frame announces, its kind for the frames
+// announcing a mac.
+func Family(frame plan.Frame) string {
+	if frame.IP == "" {
+		return frame.Kind
+	}
+	return family(frame.IP)
+}
+
+// family returns ipv4 or ipv6, and nothing for the ipv4-mapped ipv6
+// addresses, which no announcer announces.
+func family(ip string) string {
+	addr := net.ParseIP(ip)
+	switch {
+	case addr == nil:
+		return ""
+	case addr.To4() == nil:
+		return "ipv6"
+	case strings.Contains(ip, ":"):
+		return ""
+	}
+	return "ipv4"
+}
+
+// burst is how many times frame is written.
+func burst(frame plan.Frame) int {
+	if frame.Count < 1 {
+		return 1
+	}
+	return frame.Count
+}
+
+// writeFrame writes the data of frame frame.Count times, frame.Interval or
+// else RARPInterval apart, on its link, and returns how many were written.
+func writeFrame(ctx context.Context, cfg *config.Config, frame plan.Frame) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	name := frame.Link
+	if name == "" {
+		name = frame.Bridge
+	}
+	if OpenLink == nil {
+		return 0, fmt.Errorf("open %s: no link opener", name)
+	}
+	link, err := OpenLink(name)
+	if err != nil {
+		return 0, fmt.Errorf("open %s: %v", name, err)
+	}
+	defer link.Close()
+	count := burst(frame)
+	interval := frame.Interval
+	if interval == 0 {
+		interval = cfg.RARPInterval.Duration
+	}
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return i, ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+		if err := garp.Write(link, frame.Data); err != nil {
+			return i, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,243 @@
+package announce
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/garp"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/plan"
+	"ha-bridge/pkg/policy"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	v1 "kubevirt.io/client-go/api/v1"
+)
+
+func TestAllAnnouncersRegistered(t *testing.T) {
+	cfg := config.Default()
+	for _, name := range Names() {
+		cfg.Announcers = []string{name}
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("announcer %s is unknown to the configuration: %v", name, err)
+		}
+	}
+	if len(Names()) != 6 {
+		t.Errorf("unexpected announcers %v", Names())
+	}
+}
+
+func TestBuild(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	informer.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: "r"}, IPLists: []v2.IPRecorderIPLists{{IPAddress: "10.0.0.2", Vlan: 100}}})
+	ipam.RecorderInformer = informer
+
+	vmi := &v1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name = "default", "vm1"
+	vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:01", IP: "10.0.0.2", IPs: []string{"10.0.0.2", "fd00::2"}},
+		{InterfaceName: "eth1", MAC: "02:00:00:00:00:02", IP: "10.0.1.2", IPs: []string{"10.0.1.2"}},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:03", IP: "10.0.9.9", IPs: []string{"10.0.9.9"}},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:04"},
+	}
+	cfg := config.Default()
+	cfg.RARPBurst, cfg.VerifyOwnership = 0, false
+	p := Build(cfg, vmi, nil)
+
+	if len(p.Frames) != 1 {
+		t.Fatalf("unexpected frames %+v", p.Frames)
+	}
+	frame := p.Frames[0]
+	if frame.Bridge != "vlan100" || frame.Vlan != 100 || frame.IP != "10.0.0.2" || frame.Kind != config.AnnouncerGarpRequest {
+		t.Errorf("unexpected frame %+v", frame)
+	}
+	packet := gopacket.NewPacket(frame.Data, layers.LayerTypeEthernet, gopacket.Default)
+	arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || arp.Operation != layers.ARPRequest || net.IP(arp.SourceProtAddress).String() != "10.0.0.2" || net.IP(arp.DstProtAddress).String() != "10.0.0.2" {
+		t.Errorf("frame is not a gratuitous arp for 10.0.0.2: %v", packet)
+	}
+
+	want := []string{plan.ReasonInterfaceNotAnnounced, plan.ReasonIPAMLookupFailed, plan.ReasonNoIPAddress, plan.ReasonUnsupportedFamily}
+	if len(p.Skipped) != len(want) {
+		t.Fatalf("unexpected skips %+v", p.Skipped)
+	}
+	for i, reason := range want {
+		if p.Skipped[i].Reason != reason {
+			t.Errorf("skip %d: got %s, want %s", i, p.Skipped[i].Reason, reason)
+		}
+	}
+}
+
+func TestBuildRARP(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	informer.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: "r"}, IPLists: []v2.IPRecorderIPLists{{IPAddress: "10.0.0.2", Vlan: 100}}})
+	ipam.RecorderInformer = informer
+
+	vmi := &v1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name = "default", "vm1"
+	vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:01", IP: "10.0.0.2", IPs: []string{"10.0.0.2"}},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:02"},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:03"},
+	}
+	lookup := func(mac string) (string, int, bool) {
+		if mac == "02:00:00:00:00:02" {
+			return "vlan200", 200, true
+		}
+		return "", 0, false
+	}
+	cfg := config.Default()
+	cfg.VerifyOwnership = false
+	p := Build(cfg, vmi, lookup)
+
+	var got []string
+	for _, frame := range p.Frames {
+		got = append(got, fmt.Sprintf("%s %s %s %d", frame.Kind, frame.MAC, frame.Bridge, frame.Count))
+	}
+	want := []string{
+		"garp-request 02:00:00:00:00:01 vlan100 0",
+		"rarp 02:00:00:00:00:01 vlan100 5",
+		"rarp 02:00:00:00:00:02 vlan200 5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+	packet := gopacket.NewPacket(p.Frames[2].Data, layers.LayerTypeEthernet, gopacket.Default)
+	if eth, ok := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet); !ok || eth.EthernetType != garp.EthernetTypeRARP || eth.SrcMAC.String() != "02:00:00:00:00:02" {
+		t.Errorf("frame is not a rarp from 02:00:00:00:00:02: %v", packet)
+	}
+	if len(p.Skipped) != 1 || p.Skipped[0].Reason != plan.ReasonNoIPAddress || p.Skipped[0].Interface != "eth0" {
+		t.Errorf("unexpected skips %+v", p.Skipped)
+	}
+}
+
+func TestBuildTargetsPolicies(t *testing.T) {
+	cfg := config.Default()
+	cfg.QMPSocket = "/run/qmp/{namespace}_{name}.sock"
+	cfg.AnnouncerPolicies = []config.AnnouncerPolicy{
+		{Vlans: []int{200}, Announcers: []string{config.AnnouncerTaggedGarpRequest, config.AnnouncerNA, config.AnnouncerQMP}},
+	}
+	saved := uplinks
+	defer func() { uplinks = saved }()
+	uplinks = func(cfg *config.Config, bridge string) []string {
+		if bridge == "vlan200" {
+			return []string{"bond0"}
+		}
+		return nil
+	}
+	targets := []plan.Target{
+		{Namespace: "default", VMI: "vm1", Interface: "eth0", MAC: "02:00:00:00:00:01", IPs: []string{"10.0.0.2"}, Vlan: 100, Bridge: "vlan100"},
+		{Namespace: "default", VMI: "vm1", Interface: "eth1", MAC: "02:00:00:00:00:02", IPs: []string{"10.0.1.2", "fd00::2", "::ffff:10.0.1.3"}, Vlan: 200, Bridge: "vlan200"},
+		{Namespace: "default", VMI: "vm1", Interface: "eth2", MAC: "02:00:00:00:00:03", IPs: []string{"bogus"}, Vlan: 100, Bridge: "vlan100"},
+	}
+	p := BuildTargets(cfg, targets)
+
+	var got []string
+	for _, f := range p.Frames {
+		got = append(got, fmt.Sprintf("%s %s %s %s", f.Kind, f.Interface, f.IP, f.Link))
+	}
+	want := []string{
+		"garp-request eth0 10.0.0.2 ",
+		"rarp eth0  ",
+		"qmp-announce-self   ",
+		"tagged-garp-request eth1 10.0.1.2 bond0",
+		"ipv6-na eth1 fd00::2 ",
+		"rarp eth2  ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("frames =\n%q\nwant\n%q", got, want)
+	}
+	var skips []string
+	for _, s := range p.Skipped {
+		skips = append(skips, s.Interface+" "+s.IP+" "+s.Reason)
+	}
+	if want := []string{"eth1 ::ffff:10.0.1.3 UnsupportedFamily", "eth2 bogus InvalidAddress"}; !reflect.DeepEqual(skips, want) {
+		t.Errorf("skips = %q, want %q", skips, want)
+	}
+
+	uplinks = func(*config.Config, string) []string { return nil }
+	p = BuildTargets(cfg, targets[1:2])
+	if len(p.Skipped) == 0 || p.Skipped[0].Reason != plan.ReasonNoUplink || p.Skipped[0].Expected() {
+		t.Errorf("tagged frames without uplink should be an unexpected skip: %+v", p.Skipped)
+	}
+}
+
+func TestBuildTargetsAnnouncePolicy(t *testing.T) {
+	saved := policy.PolicyInformer
+	defer func() { policy.PolicyInformer = saved }()
+	policy.PolicyInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &v1alpha1.AnnouncePolicy{}, 0, cache.Indexers{})
+	disabled := false
+	policy.PolicyInformer.GetStore().Add(&v1alpha1.AnnouncePolicy{ObjectMeta: metav1.ObjectMeta{Name: "pool-a"},
+		Spec: v1alpha1.AnnouncePolicySpec{IPPools: []string{"pool-a"}, Burst: 3,
+			Interval: &metav1.Duration{Duration: 10 * time.Millisecond}, Priority: 5}})
+	policy.PolicyInformer.GetStore().Add(&v1alpha1.AnnouncePolicy{ObjectMeta: metav1.ObjectMeta{Name: "off"},
+		Spec: v1alpha1.AnnouncePolicySpec{Vlans: &v1alpha1.VlanRange{From: 300, To: 399}, Enabled: &disabled}})
+
+	cfg := config.Default()
+	p := BuildTargets(cfg, []plan.Target{
+		{Namespace: "default", VMI: "vm1", Interface: "eth0", MAC: "02:00:00:00:00:01", IPs: []string{"10.0.0.2"}, Vlan: 100, Bridge: "vlan100", Pool: "pool-a"},
+		{Namespace: "default", VMI: "vm1", Interface: "eth1", MAC: "02:00:00:00:00:02", IPs: []string{"10.0.3.2"}, Vlan: 300, Bridge: "vlan300"},
+		{Namespace: "default", VMI: "vm2", Interface: "eth0", MAC: "02:00:00:00:00:03", IPs: []string{"10.0.3.3"}, Vlan: 300, Bridge: "vlan300", Enabled: true},
+	})
+	if len(p.Frames) != 4 {
+		t.Fatalf("unexpected frames %+v", p.Frames)
+	}
+	for _, f := range p.Frames[:2] {
+		if f.Interface != "eth0" || f.Policy != "pool-a" || f.Count != 3 || f.Interval != 10*time.Millisecond || f.Priority != 5 {
+			t.Errorf("frame does not follow policy pool-a: %+v", f)
+		}
+	}
+	if len(p.Skipped) != 1 || p.Skipped[0].Interface != "eth1" || p.Skipped[0].Reason != plan.ReasonDisabled || !p.Skipped[0].Expected() {
+		t.Errorf("a disabled interface should be an expected skip: %+v", p.Skipped)
+	}
+	for _, f := range p.Frames[2:] {
+		if f.VMI != "vm2" || f.Policy != "off" {
+			t.Errorf("a vmi opting in should be announced over its policy: %+v", f)
+		}
+	}
+}
+
+// recordingLink records the frames written on it.
+type recordingLink struct {
+	written [][]byte
+}
+
+func (l *recordingLink) WritePacketData(data []byte) error {
+	l.written = append(l.written, data)
+	return nil
+}
+
+func (l *recordingLink) Close() {}
+
+func TestSend(t *testing.T) {
+	cfg := config.Default()
+	cfg.RARPInterval.Duration = 0
+	links := map[string]*recordingLink{}
+	saved := OpenLink
+	defer func() { OpenLink = saved }()
+	OpenLink = func(name string) (Link, error) {
+		if links[name] == nil {
+			links[name] = &recordingLink{}
+		}
+		return links[name], nil
+	}
+	p := BuildTargets(cfg, []plan.Target{{VMI: "tap0", Interface: "tap0", MAC: "02:00:00:00:00:01", Vlan: 100, Bridge: "vlan100"}})
+	if len(p.Frames) != 1 {
+		t.Fatalf("unexpected frames %+v", p.Frames)
+	}
+	written, err := Send(context.Background(), cfg, p.Frames[0])
+	if err != nil || written != cfg.RARPBurst || len(links["vlan100"].written) != cfg.RARPBurst {
+		t.Errorf("a rarp burst should write %d frames: %d, %v", cfg.RARPBurst, written, err)
+	}
+	if _, err := Send(context.Background(), cfg, plan.Frame{Kind: "smoke-signals"}); err == nil {
+		t.Error("a frame of an unknown announcer should fail")
+	}
+}
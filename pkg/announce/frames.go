@@ -0,0 +1,159 @@
+package announce
+
+import (
+	"context"
+	"fmt"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/garp"
+	"ha-bridge/pkg/plan"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// sysClassNet is where the kernel lists the links and their bridge ports.
+const sysClassNet = "/sys/class/net"
+
+func init() {
+	Register(&addressAnnouncer{name: config.AnnouncerGarpRequest, family: "ipv4",
+		build: func(ip net.IP, mac net.HardwareAddr, _ int) ([]byte, error) { return garp.NewGratuitousArp(ip, mac) }})
+	Register(&addressAnnouncer{name: config.AnnouncerGarpReply, family: "ipv4",
+		build: func(ip net.IP, mac net.HardwareAddr, _ int) ([]byte, error) { return garp.NewGratuitousReply(ip, mac) }})
+	Register(&addressAnnouncer{name: config.AnnouncerNA, family: "ipv6",
+		build: func(ip net.IP, mac net.HardwareAddr, _ int) ([]byte, error) { return garp.NewUnsolicitedNA(ip, mac) }})
+	Register(&addressAnnouncer{name: config.AnnouncerTaggedGarpRequest, family: "ipv4", tagged: true,
+		build: garp.NewTaggedGratuitousArp})
+	Register(rarpAnnouncer{})
+}
+
+// addressAnnouncer writes a frame per address of one family.
+type addressAnnouncer struct {
+	name   string
+	family string
+	build  func(ip net.IP, mac net.HardwareAddr, vlan int) ([]byte, error)
+	// tagged frames are written on the bonds under the bridge, which carry
+	// the vlan tagged
+	tagged bool
+}
+
+func (a *addressAnnouncer) Name() string {
+	return a.name
+}
+
+func (a *addressAnnouncer) Plan(cfg *config.Config, t plan.Target) *plan.Plan {
+	p := &plan.Plan{}
+	skip := func(ip, reason, format string, args ...interface{}) {
+		p.Skipped = append(p.Skipped, plan.Skip{Namespace: t.Namespace, VMI: t.VMI, Interface: t.Interface, IP: ip,
+			Reason: reason, Message: fmt.Sprintf(format, args...)})
+	}
+	var ips []string
+	for _, ip := range t.IPs {
+		if family(ip) == a.family {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		return p
+	}
+	mac, err := net.ParseMAC(t.MAC)
+	if err != nil {
+		skip("", plan.ReasonInvalidAddress, "interface %q: %v", t.Interface, err)
+		return p
+	}
+	links := []string{""}
+	if a.tagged {
+		links = uplinks(cfg, t.Bridge)
+		if len(links) == 0 {
+			for _, ip := range ips {
+				skip(ip, plan.ReasonNoUplink, "no bond of %s is a port of bridge %s", strings.Join(cfg.Bonds, ", "), t.Bridge)
+			}
+			return p
+		}
+	}
+	for _, ip := range ips {
+		data, err := a.build(net.ParseIP(ip), mac, t.Vlan)
+		if err != nil {
+			skip(ip, plan.ReasonInvalidAddress, "build %s for %s: %v", a.name, ip, err)
+			continue
+		}
+		for _, link := range links {
+			p.Frames = append(p.Frames, plan.Frame{
+				Namespace: t.Namespace,
+				VMI:       t.VMI,
+				Interface: t.Interface,
+				Bridge:    t.Bridge,
+				Vlan:      t.Vlan,
+				Kind:      a.name,
+				Link:      link,
+				IP:        ip,
+				MAC:       t.MAC,
+				Data:      data,
+			})
+		}
+	}
+	return p
+}
+
+func (a *addressAnnouncer) Send(ctx context.Context, cfg *config.Config, frame plan.Frame) (int, error) {
+	return writeFrame(ctx, cfg, frame)
+}
+
+// rarpAnnouncer writes a burst of RARPBurst reverse arp requests per
+// interface, as QEMU's announce_self does.
+type rarpAnnouncer struct{}
+
+func (rarpAnnouncer) Name() string {
+	return config.AnnouncerRARP
+}
+
+func (rarpAnnouncer) Plan(cfg *config.Config, t plan.Target) *plan.Plan {
+	p := &plan.Plan{}
+	if cfg.RARPBurst == 0 {
+		return p
+	}
+	mac, err := net.ParseMAC(t.MAC)
+	if err == nil {
+		var data []byte
+		if data, err = garp.NewRARP(mac); err == nil {
+			p.Frames = append(p.Frames, plan.Frame{
+				Namespace: t.Namespace,
+				VMI:       t.VMI,
+				Interface: t.Interface,
+				Bridge:    t.Bridge,
+				Vlan:      t.Vlan,
+				Kind:      config.AnnouncerRARP,
+				MAC:       t.MAC,
+				Data:      data,
+				Count:     cfg.RARPBurst,
+			})
+			return p
+		}
+	}
+	p.Skipped = append(p.Skipped, plan.Skip{Namespace: t.Namespace, VMI: t.VMI, Interface: t.Interface,
+		Reason: plan.ReasonInvalidAddress, Message: fmt.Sprintf("build rarp for %s: %v", t.MAC, err)})
+	return p
+}
+
+func (rarpAnnouncer) Send(ctx context.Context, cfg *config.Config, frame plan.Frame) (int, error) {
+	return writeFrame(ctx, cfg, frame)
+}
+
+// uplinks returns the monitored bonds enslaved to bridge, directly or by a
+// vlan subinterface; tests replace it.
+var uplinks = func(cfg *config.Config, bridge string) []string {
+	ports, err := ioutil.ReadDir(filepath.Join(sysClassNet, bridge, "brif"))
+	if err != nil {
+		return nil
+	}
+	var bonds []string
+	for _, bond := range cfg.Bonds {
+		for _, port := range ports {
+			if port.Name() == bond || strings.HasPrefix(port.Name(), bond+".") {
+				bonds = append(bonds, bond)
+				break
+			}
+		}
+	}
+	return bonds
+}
@@ -0,0 +1,51 @@
+package announce
+
+import (
+	"context"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/plan"
+	"ha-bridge/pkg/qmp"
+	"time"
+)
+
+// qmpTimeout bounds the exchange with the QMP socket of one VMI.
+const qmpTimeout = 5 * time.Second
+
+func init() {
+	Register(qmpAnnouncer{})
+}
+
+// qmpAnnouncer has QEMU announce the guest through the QMP socket QMPSocket
+// finds. announce-self announces every nic of the guest, so it plans one
+// frame, without interface, per VMI.
+type qmpAnnouncer struct{}
+
+func (qmpAnnouncer) Name() string {
+	return config.AnnouncerQMP
+}
+
+func (qmpAnnouncer) Plan(cfg *config.Config, t plan.Target) *plan.Plan {
+	p := &plan.Plan{}
+	// discovery knows the ports, not the VMIs behind them
+	if cfg.QMPSocket == "" || t.Namespace == "" {
+		return p
+	}
+	p.Frames = append(p.Frames, plan.Frame{Namespace: t.Namespace, VMI: t.VMI, Kind: config.AnnouncerQMP})
+	return p
+}
+
+func (qmpAnnouncer) Send(ctx context.Context, cfg *config.Config, frame plan.Frame) (int, error) {
+	if err := announceSelf(ctx, cfg, frame.Namespace, frame.VMI); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// announceSelf has the QEMU of the VMI namespace/name announce the guest;
+// tests replace it.
+var announceSelf = func(ctx context.Context, cfg *config.Config, namespace, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, qmpTimeout)
+	defer cancel()
+	return qmp.AnnounceVMI(ctx, cfg.QMPSocket, namespace, name,
+		qmp.Announce{Rounds: cfg.QMPAnnounceRounds, Step: cfg.QMPAnnounceStep.Duration})
+}
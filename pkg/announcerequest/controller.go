@@ -0,0 +1,193 @@
+package announcerequest
+
+import (
+	"context"
+	"fmt"
+	"ha-bridge/api/habridge/v1alpha1"
+	habridgev1alpha1 "ha-bridge/generated/habridge/clientset/versioned/typed/habridge/v1alpha1"
+	informers "ha-bridge/generated/habridge/informers/externalversions/habridge/v1alpha1"
+	listers "ha-bridge/generated/habridge/listers/habridge/v1alpha1"
+	"ha-bridge/pkg/failover"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	kubev1 "kubevirt.io/client-go/api/v1"
+	"time"
+)
+
+// maxErrors bounds the errors a node reports per request.
+const maxErrors = 10
+
+// Controller runs a scoped announcement round on this node for every new
+// generation of an AnnounceRequest, and reports the outcome in the entry of
+// the request status that belongs to this node.
+type Controller struct {
+	client habridgev1alpha1.AnnounceRequestsGetter
+	lister listers.AnnounceRequestLister
+	synced cache.InformerSynced
+	queue  workqueue.RateLimitingInterface
+	node   string
+}
+
+// NewController watches the AnnounceRequests of informer on behalf of node.
+func NewController(client habridgev1alpha1.AnnounceRequestsGetter, informer informers.AnnounceRequestInformer, node string) *Controller {
+	c := &Controller{
+		client: client,
+		lister: informer.Lister(),
+		synced: informer.Informer().HasSynced,
+		queue:  workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "announcerequests"),
+		node:   node,
+	}
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.enqueue,
+		UpdateFunc: func(_, obj interface{}) { c.enqueue(obj) },
+	})
+	return c
+}
+
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// Run handles requests until ctx is done. Requests are handled one at a
+// time; their rounds are serialised with the failover rounds anyway.
+func (c *Controller) Run(ctx context.Context) {
+	defer c.queue.ShutDown()
+	if !cache.WaitForCacheSync(ctx.Done(), c.synced) {
+		return
+	}
+	go wait.Until(func() {
+		for c.processNextItem(ctx) {
+		}
+	}, time.Second, ctx.Done())
+	<-ctx.Done()
+}
+
+func (c *Controller) processNextItem(ctx context.Context) bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+	if err := c.sync(ctx, key.(string)); err != nil {
+		klog.Errorf("handle AnnounceRequest %s: %v", key, err)
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	return true
+}
+
+func (c *Controller) sync(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	req, err := c.lister.AnnounceRequests(namespace).Get(name)
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !needsRound(req, c.node) {
+		return nil
+	}
+	result := v1alpha1.NodeAnnounceResult{Node: c.node, ObservedGeneration: req.Generation}
+	match, err := Matcher(req)
+	if err != nil {
+		result.Result = "Failed"
+		result.Errors = []string{err.Error()}
+	} else {
+		klog.Infof("announce the vmis selected by AnnounceRequest %s", key)
+		report := failover.Announce(ctx, failover.Cause{Source: failover.SourceAnnounceRequest, Request: key}, match)
+		result.Result = report.Result()
+		result.VMIs = report.Announced()
+		result.FramesSent = report.Sent
+		result.FramesFailed = report.Failed
+		result.Errors = report.Errors(maxErrors)
+		result.Announcers = report.AnnouncerResults()
+	}
+	result.Time = metav1.Now()
+	return c.applyStatus(req, result)
+}
+
+// applyStatus writes this node's entry of the request status. Each node
+// applies as its own field manager, so the entries of the other nodes are
+// left alone.
+func (c *Controller) applyStatus(req *v1alpha1.AnnounceRequest, result v1alpha1.NodeAnnounceResult) error {
+	status := &v1alpha1.AnnounceRequest{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "AnnounceRequest"},
+		ObjectMeta: metav1.ObjectMeta{Namespace: req.Namespace, Name: req.Name},
+		Status:     v1alpha1.AnnounceRequestStatus{Nodes: []v1alpha1.NodeAnnounceResult{result}},
+	}
+	_, err := c.client.AnnounceRequests(req.Namespace).ApplyStatus(status, FieldManager(c.node), true)
+	return err
+}
+
+// FieldManager is the field manager node applies request status as.
+func FieldManager(node string) string {
+	return "habridge-" + node
+}
+
+// needsRound reports whether node has yet to act on the current generation
+// of req.
+func needsRound(req *v1alpha1.AnnounceRequest, node string) bool {
+	if len(req.Spec.NodeNames) > 0 && !contains(req.Spec.NodeNames, node) {
+		return false
+	}
+	for _, result := range req.Status.Nodes {
+		if result.Node == node {
+			return result.ObservedGeneration < req.Generation
+		}
+	}
+	return true
+}
+
+// Matcher returns the predicate selecting the VMIs req asks for. A request
+// only selects VMIs of its own namespace, so that whoever may create one in
+// a namespace cannot have the VMIs of another tenant announced.
+func Matcher(req *v1alpha1.AnnounceRequest) (func(*kubev1.VirtualMachineInstance) bool, error) {
+	for _, namespace := range req.Spec.Namespaces {
+		if namespace != req.Namespace {
+			return nil, fmt.Errorf("namespace %s is not the request's own", namespace)
+		}
+	}
+	selector := labels.Everything()
+	if req.Spec.Selector != nil {
+		var err error
+		selector, err = metav1.LabelSelectorAsSelector(req.Spec.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector: %v", err)
+		}
+	}
+	names := req.Spec.VMIs
+	return func(vmi *kubev1.VirtualMachineInstance) bool {
+		if vmi.Namespace != req.Namespace {
+			return false
+		}
+		if len(names) > 0 && !contains(names, vmi.Name) {
+			return false
+		}
+		return selector.Matches(labels.Set(vmi.Labels))
+	}, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
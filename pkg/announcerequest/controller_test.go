@@ -0,0 +1,75 @@
+package announcerequest
+
+import (
+	"testing"
+
+	"ha-bridge/api/habridge/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubev1 "kubevirt.io/client-go/api/v1"
+)
+
+func newVMI(namespace, name string, labels map[string]string) *kubev1.VirtualMachineInstance {
+	vmi := &kubev1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name, vmi.Labels = namespace, name, labels
+	return vmi
+}
+
+func TestMatcher(t *testing.T) {
+	cases := []struct {
+		name string
+		spec v1alpha1.AnnounceRequestSpec
+		want map[string]bool
+	}{
+		{"own namespace", v1alpha1.AnnounceRequestSpec{}, map[string]bool{"a/vm1": true, "a/vm2": true, "b/vm1": false}},
+		{"by name", v1alpha1.AnnounceRequestSpec{VMIs: []string{"vm1"}}, map[string]bool{"a/vm1": true, "a/vm2": false}},
+		{"own namespace named", v1alpha1.AnnounceRequestSpec{Namespaces: []string{"a"}}, map[string]bool{"a/vm1": true, "b/vm1": false}},
+		{"by selector", v1alpha1.AnnounceRequestSpec{Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}},
+			map[string]bool{"a/vm1": true, "a/vm2": false}},
+	}
+	vmis := map[string]*kubev1.VirtualMachineInstance{
+		"a/vm1": newVMI("a", "vm1", map[string]string{"app": "db"}),
+		"a/vm2": newVMI("a", "vm2", nil),
+		"b/vm1": newVMI("b", "vm1", map[string]string{"app": "db"}),
+	}
+	for _, c := range cases {
+		req := &v1alpha1.AnnounceRequest{Spec: c.spec}
+		req.Namespace = "a"
+		match, err := Matcher(req)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		for key, want := range c.want {
+			if got := match(vmis[key]); got != want {
+				t.Errorf("%s: %s matched %v, want %v", c.name, key, got, want)
+			}
+		}
+	}
+
+	bad := &v1alpha1.AnnounceRequest{Spec: v1alpha1.AnnounceRequestSpec{Selector: &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "app", Operator: "Bogus"}},
+	}}}
+	if _, err := Matcher(bad); err == nil {
+		t.Error("expected an invalid selector to be rejected")
+	}
+	other := &v1alpha1.AnnounceRequest{Spec: v1alpha1.AnnounceRequestSpec{Namespaces: []string{"a", "b"}}}
+	other.Namespace = "a"
+	if _, err := Matcher(other); err == nil {
+		t.Error("expected a request for another namespace to be rejected")
+	}
+}
+
+func TestNeedsRound(t *testing.T) {
+	req := &v1alpha1.AnnounceRequest{}
+	req.Generation = 2
+	if !needsRound(req, "node-a") {
+		t.Error("a node that has not acted should act")
+	}
+	req.Status.Nodes = []v1alpha1.NodeAnnounceResult{{Node: "node-a", ObservedGeneration: 2}, {Node: "node-b", ObservedGeneration: 1}}
+	if needsRound(req, "node-a") || !needsRound(req, "node-b") {
+		t.Error("only nodes behind the current generation should act")
+	}
+	req.Spec.NodeNames = []string{"node-c"}
+	if needsRound(req, "node-b") {
+		t.Error("nodes not listed should not act")
+	}
+}
@@ -1,32 +1,85 @@
 package bond
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"ha-bridge/pkg/config"
 	"ha-bridge/pkg/failover"
+	"ha-bridge/pkg/health"
+	"ha-bridge/pkg/metrics"
 	"k8s.io/klog/v2"
 	"net"
 	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
-const ifaceName = "bond0"
+// readTimeout bounds each netlink read so the listener notices ctx being
+// cancelled even when no link events arrive.
+const readTimeout = time.Second
 
-func Start() {
-	GetNotifyArp(ifaceName)
+// listenerStall is how long the listener loop may stop turning before the
+// liveness probe fails; each read returns within readTimeout.
+const listenerStall = 30 * readTimeout
+
+var (
+	// bound is set while the netlink socket is bound.
+	bound          int32
+	listenerHealth = health.Register("netlink", func() error {
+		if atomic.LoadInt32(&bound) == 0 {
+			return errors.New("netlink socket is not bound")
+		}
+		return nil
+	}, listenerStall)
+	_ = health.Register("bonds", checkBonds, 0)
+)
+
+// Start listens for failover of the configured bonds until ctx is cancelled.
+func Start(ctx context.Context) {
+	GetNotifyArp(ctx)
 }
 
-func GetNotifyArp(bond string) {
+// GetNotifyArp triggers a failover round when one of bonds comes up. With no
+// bonds given it follows the bonds of the configuration in effect.
+func GetNotifyArp(ctx context.Context, bonds ...string) {
+	isBond := func(name string) bool {
+		if len(bonds) == 0 {
+			return config.Get().IsBond(name)
+		}
+		for _, bond := range bonds {
+			if bond == name {
+				return true
+			}
+		}
+		return false
+	}
 	l, err := ListenNetlink()
 	if err != nil {
 		klog.Error(err)
+		listenerHealth.Error(err)
 		return
 	}
+	defer l.Close()
+	atomic.StoreInt32(&bound, 1)
+	defer atomic.StoreInt32(&bound, 0)
+	for _, bond := range config.Get().Bonds {
+		updateActiveSlave(bond)
+	}
+	catchUp()
 
 	for {
+		if ctx.Err() != nil {
+			klog.Infoln("stop netlink listener")
+			return
+		}
+		listenerHealth.Progress()
 		msgs, err := l.ReadMsgs()
 		if err != nil {
-			klog.Error("Could not read netlink:\n %s", err) // can't find this netlink
+			klog.Errorf("Could not read netlink:\n %s", err) // can't find this netlink
+			listenerHealth.Error(err)
 		}
 	loop:
 		for _, m := range msgs {
@@ -34,13 +87,25 @@ func GetNotifyArp(bond string) {
 			case syscall.NLMSG_DONE, syscall.NLMSG_ERROR:
 				break loop
 			case syscall.RTM_NEWLINK, syscall.RTM_DELLINK: // get netlink message
+				metrics.LinkEventsTotal.WithLabelValues(linkEventType(&m)).Inc()
+				slaves := map[string][2]string{}
+				changed := false
+				for _, bond := range config.Get().Bonds {
+					old, current := updateActiveSlave(bond)
+					slaves[bond] = [2]string{old, current}
+					changed = changed || old != current
+				}
+				if changed {
+					persistActiveSlaves()
+				}
 				res, err := PrintLinkMsg(&m)
 				if err != nil {
 					klog.Error("Could not find netlink ", err)
 				} else {
 					ethInfo := strings.Fields(res)
-					if ethInfo[2] == bond && ethInfo[1] == "up" {
-						failover.OnBondFailOver()
+					if len(ethInfo) == 3 && isBond(ethInfo[2]) && ethInfo[1] == "up" {
+						slave := slaves[ethInfo[2]]
+						failover.TriggerBond(ethInfo[2], slave[0], slave[1])
 					}
 				}
 			}
@@ -71,9 +136,17 @@ func ListenNetlink() (*NetlinkListener, error) { // Listen netlink
 
 	err = syscall.Bind(s, saddr)
 	if err != nil {
+		syscall.Close(s)
 		return nil, fmt.Errorf("bind: %s", err)
 	}
 
+	tv := syscall.NsecToTimeval(readTimeout.Nanoseconds())
+	err = syscall.SetsockoptTimeval(s, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv)
+	if err != nil {
+		syscall.Close(s)
+		return nil, fmt.Errorf("set read timeout: %s", err)
+	}
+
 	return &NetlinkListener{fd: s, sa: saddr}, nil
 }
 
@@ -90,6 +163,10 @@ func (l *NetlinkListener) ReadMsgs() ([]syscall.NetlinkMessage, error) { // read
 	pkt := make([]byte, 2048)
 
 	n, err := syscall.Read(l.fd, pkt)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		// read timed out, give the caller a chance to check for shutdown
+		return nil, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("read: %s", err)
 	}
@@ -102,6 +179,25 @@ func (l *NetlinkListener) ReadMsgs() ([]syscall.NetlinkMessage, error) { // read
 	return msgs, nil
 }
 
+func (l *NetlinkListener) Close() error {
+	return syscall.Close(l.fd)
+}
+
+// linkEventType names the kind of link message for the link events counter.
+func linkEventType(msg *syscall.NetlinkMessage) string {
+	if msg.Header.Type == syscall.RTM_DELLINK {
+		return "dellink"
+	}
+	if len(msg.Data) < syscall.SizeofIfInfomsg {
+		return "newlink"
+	}
+	ifim := (*syscall.IfInfomsg)(unsafe.Pointer(&msg.Data[0]))
+	if ifim.Flags&syscall.IFF_UP != 0 {
+		return "newlink_up"
+	}
+	return "newlink_down"
+}
+
 func PrintLinkMsg(msg *syscall.NetlinkMessage) (string, error) { // when netlink changed, function can listen the message and notify user
 	defer func() {
 		recover()
@@ -126,7 +222,3 @@ func PrintLinkMsg(msg *syscall.NetlinkMessage) (string, error) { // when netlink
 
 	return res, nil
 }
-
-func Print() {
-	klog.Warning("bond0 failover......")
-}
@@ -1,7 +1,109 @@
 package bond
 
-import "testing"
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/failover"
+)
 
 func Test(t *testing.T) {
-	GetNotifyArp(ifaceName)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	cfg := config.Default()
+	cfg.StateDir = ""
+	config.Set(cfg)
+	defer config.Set(config.Default())
+	GetNotifyArp(ctx, "bond0")
+}
+
+func TestUpdateActiveSlave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "habridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedDir, savedSlaves := sysClassNet, activeSlaves
+	defer func() { sysClassNet, activeSlaves = savedDir, savedSlaves }()
+	sysClassNet, activeSlaves = dir, map[string]string{}
+	if err := os.MkdirAll(filepath.Join(dir, "bond9", "bonding"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	setActive := func(slave string) {
+		path := filepath.Join(dir, "bond9", "bonding", "active_slave")
+		if err := ioutil.WriteFile(path, []byte(slave+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setActive("eth0")
+	if old, current := updateActiveSlave("bond9"); old != "" || current != "eth0" {
+		t.Fatalf("got %q -> %q", old, current)
+	}
+	setActive("eth1")
+	if old, current := updateActiveSlave("bond9"); old != "eth0" || current != "eth1" {
+		t.Fatalf("got %q -> %q", old, current)
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "habridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedDir, savedSlaves := sysClassNet, activeSlaves
+	defer func() { sysClassNet, activeSlaves = savedDir, savedSlaves }()
+	sysClassNet, activeSlaves = dir, map[string]string{}
+	cfg := config.Default()
+	cfg.Bonds = []string{"bond8", "bond9"}
+	cfg.StateDir = dir
+	config.Set(cfg)
+	defer config.Set(config.Default())
+	var rounds []string
+	triggerStartup = func(bond, oldSlave, newSlave string) bool {
+		rounds = append(rounds, bond+":"+oldSlave+"->"+newSlave)
+		return true
+	}
+	defer func() { triggerStartup = failover.TriggerStartup }()
+	for bond, slave := range map[string]string{"bond8": "eth0", "bond9": "eth3"} {
+		if err := os.MkdirAll(filepath.Join(dir, bond, "bonding"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, bond, "bonding", "active_slave"), []byte(slave+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		updateActiveSlave(bond)
+	}
+
+	catchUp()
+	if len(rounds) != 0 {
+		t.Errorf("a first start should not announce by default: %v", rounds)
+	}
+	saved, err := loadState(filepath.Join(dir, stateFile))
+	if err != nil || saved == nil || saved.ActiveSlaves["bond9"] != "eth3" {
+		t.Fatalf("state not saved: %+v, %v", saved, err)
+	}
+
+	saved.ActiveSlaves["bond9"] = "eth2"
+	if err := saveState(filepath.Join(dir, stateFile), saved); err != nil {
+		t.Fatal(err)
+	}
+	catchUp()
+	if len(rounds) != 1 || rounds[0] != "bond9:eth2->eth3" {
+		t.Errorf("expected a round for bond9 only, got %v", rounds)
+	}
+
+	rounds = nil
+	os.Remove(filepath.Join(dir, stateFile))
+	cfg.AnnounceOnFirstStart = true
+	catchUp()
+	if len(rounds) != 1 || rounds[0] != ":->" {
+		t.Errorf("expected one round without state, got %v", rounds)
+	}
 }
@@ -0,0 +1,68 @@
+package bond
+
+import (
+	"fmt"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/metrics"
+	"io/ioutil"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// sysClassNet is where the bonding driver publishes bond state.
+var sysClassNet = "/sys/class/net"
+
+var (
+	slaveMutex   = sync.Mutex{}
+	activeSlaves = map[string]string{}
+)
+
+// checkBonds reports the configured bonds the bonding driver does not know.
+func checkBonds() error {
+	var missing []string
+	for _, bond := range config.Get().Bonds {
+		if _, err := os.Stat(filepath.Join(sysClassNet, bond, "bonding")); err != nil {
+			missing = append(missing, bond)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("bonds not found: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ActiveSlave returns the active slave of bond, empty when it has none.
+func ActiveSlave(bond string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(sysClassNet, bond, "bonding", "active_slave"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// updateActiveSlave re-reads the active slave of bond and returns the one it
+// replaced, keeping the active slave gauge in step.
+func updateActiveSlave(bond string) (old, current string) {
+	current, err := ActiveSlave(bond)
+	if err != nil {
+		klog.V(4).Infof("read active slave of %s: %v", bond, err)
+	}
+	slaveMutex.Lock()
+	defer slaveMutex.Unlock()
+	old = activeSlaves[bond]
+	if old == current {
+		return old, current
+	}
+	if old != "" {
+		metrics.BondActiveSlave.DeleteLabelValues(bond, old)
+	}
+	if current != "" {
+		metrics.BondActiveSlave.WithLabelValues(bond, current).Set(1)
+	}
+	activeSlaves[bond] = current
+	klog.Infof("active slave of %s changed from %q to %q", bond, old, current)
+	return old, current
+}
@@ -0,0 +1,106 @@
+package bond
+
+import (
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/failover"
+	"ha-bridge/pkg/statefile"
+	"k8s.io/klog/v2"
+	"path/filepath"
+	"time"
+)
+
+// stateFile is the file of the state directory holding the active slaves.
+const stateFile = "bonds.json"
+
+// state is what the agent remembers of the bonds across restarts.
+type state struct {
+	// ActiveSlaves maps each bond to the active slave last observed.
+	ActiveSlaves map[string]string `json:"activeSlaves"`
+	UpdateTime   time.Time         `json:"updateTime"`
+}
+
+// triggerStartup requests the catch-up rounds; tests replace it.
+var triggerStartup = failover.TriggerStartup
+
+// statePath returns the state file, empty when no state is kept.
+func statePath() string {
+	dir := config.Get().StateDir
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, stateFile)
+}
+
+// loadState reads the state file at path. A missing file is no error and
+// gives a nil state.
+func loadState(path string) (*state, error) {
+	s := &state{}
+	if ok, err := statefile.Read(path, s); !ok {
+		return nil, err
+	}
+	return s, nil
+}
+
+// saveState replaces the state file at path with s, never leaving a
+// truncated one behind.
+func saveState(path string, s *state) error {
+	return statefile.Write(path, s)
+}
+
+// persistActiveSlaves saves the active slaves observed so far.
+func persistActiveSlaves() {
+	path := statePath()
+	if path == "" {
+		return
+	}
+	s := &state{ActiveSlaves: map[string]string{}, UpdateTime: time.Now()}
+	slaveMutex.Lock()
+	for bond, slave := range activeSlaves {
+		s.ActiveSlaves[bond] = slave
+	}
+	err := saveState(path, s)
+	slaveMutex.Unlock()
+	if err != nil {
+		klog.Errorf("save bond state: %v", err)
+	}
+}
+
+// catchUp compares the active slaves read at startup with those saved
+// before the agent went down, and triggers a round for every bond that failed
+// over in between. Without saved state it triggers one round when the
+// configuration asks for it.
+func catchUp() {
+	path := statePath()
+	if path == "" {
+		return
+	}
+	previous, err := loadState(path)
+	defer persistActiveSlaves()
+	if err != nil {
+		// whatever happened while the agent was down is unknown
+		klog.Errorf("load bond state, announce all vmis: %v", err)
+		triggerStartup("", "", "")
+		return
+	}
+	if previous == nil {
+		if config.Get().AnnounceOnFirstStart {
+			klog.Infof("no bond state in %s, announce all vmis", path)
+			triggerStartup("", "", "")
+		}
+		return
+	}
+	slaveMutex.Lock()
+	current := map[string]string{}
+	for bond, slave := range activeSlaves {
+		current[bond] = slave
+	}
+	slaveMutex.Unlock()
+	for _, bond := range config.Get().Bonds {
+		old, ok := previous.ActiveSlaves[bond]
+		if !ok || current[bond] == "" || old == current[bond] {
+			continue
+		}
+		klog.Infof("active slave of %s changed from %q to %q while habridge was down", bond, old, current[bond])
+		triggerStartup(bond, old, current[bond])
+	}
+}
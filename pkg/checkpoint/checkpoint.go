@@ -0,0 +1,122 @@
+// Package checkpoint keeps on disk where the VMIs of this node are announced,
+// so a round can still announce them when the API server is unreachable and
+// the informers are stale or have never synced.
+package checkpoint
+
+import (
+	"context"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/plan"
+	"ha-bridge/pkg/statefile"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	v1 "kubevirt.io/client-go/api/v1"
+	"net"
+	"path/filepath"
+	"time"
+)
+
+// VMI is a local VMI and the interfaces a round announces for it.
+type VMI struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	UID       types.UID         `json:"uid"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Targets   []plan.Target     `json:"targets"`
+}
+
+// Object returns a VMI object carrying what the checkpoint knows of v, for
+// the round matchers and the events.
+func (v *VMI) Object() *v1.VirtualMachineInstance {
+	vmi := &v1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name, vmi.UID, vmi.Labels = v.Namespace, v.Name, v.UID, v.Labels
+	return vmi
+}
+
+// Checkpoint is the mapping of the local VMIs to their announced interfaces.
+type Checkpoint struct {
+	Node string    `json:"node"`
+	Time time.Time `json:"time"`
+	VMIs []VMI     `json:"vmis"`
+	// Cidrs are the cidrs of the IPPools of each vlan, which bound the
+	// addresses discovery learns and announces.
+	Cidrs map[int][]string `json:"cidrs,omitempty"`
+	// OptedOut are the macs of the interfaces of the VMIs opting out of the
+	// announcements, which discovery leaves alone.
+	OptedOut []string `json:"optedOut,omitempty"`
+}
+
+// InPools tells whether ip is within the cidr of an IPPool of vlan.
+func (c *Checkpoint) InPools(vlan int, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, cidr := range c.Cidrs[vlan] {
+		if _, n, err := net.ParseCIDR(cidr); err == nil && n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOptedOut tells whether the interface at mac opts out.
+func (c *Checkpoint) IsOptedOut(mac string) bool {
+	if hw, err := net.ParseMAC(mac); err == nil {
+		mac = hw.String()
+	}
+	for _, m := range c.OptedOut {
+		if m == mac {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the checkpoint at path. A missing file is no error and gives a
+// nil checkpoint.
+func Load(path string) (*Checkpoint, error) {
+	c := &Checkpoint{}
+	if ok, err := statefile.Read(path, c); !ok {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save replaces the checkpoint at path with c, never leaving a truncated one
+// behind.
+func Save(path string, c *Checkpoint) error {
+	return statefile.Write(path, c)
+}
+
+// file is the file of the state directory holding the checkpoint.
+const file = "checkpoint.json"
+
+// Path returns the checkpoint file, empty when no state is kept.
+func Path() string {
+	dir := config.Get().StateDir
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, file)
+}
+
+// Run saves the checkpoint built by current every CheckpointInterval until
+// ctx is done. current returns false while its sources are not synced, in
+// which case the previous checkpoint is kept.
+func Run(ctx context.Context, current func() (*Checkpoint, bool)) {
+	for {
+		if path := Path(); path != "" {
+			if c, ok := current(); ok {
+				if err := Save(path, c); err != nil {
+					klog.Errorf("save checkpoint: %v", err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.Get().CheckpointInterval.Duration):
+		}
+	}
+}
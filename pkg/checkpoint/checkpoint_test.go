@@ -0,0 +1,63 @@
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ha-bridge/pkg/plan"
+)
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, file)
+	if c, err := Load(path); c != nil || err != nil {
+		t.Fatalf("a missing checkpoint should load as nil: %v, %v", c, err)
+	}
+
+	want := &Checkpoint{Node: "node-a", Time: time.Now().Truncate(time.Second), VMIs: []VMI{{
+		Namespace: "default", Name: "vm1", UID: "uid-1", Labels: map[string]string{"app": "db"},
+		Targets: []plan.Target{{Namespace: "default", VMI: "vm1", Interface: "eth0", MAC: "02:00:00:00:00:01", IPs: []string{"10.0.0.2"}, Vlan: 100, Bridge: "vlan100"}},
+	}}}
+	if err := Save(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Time.Equal(want.Time) {
+		t.Errorf("time %v, want %v", got.Time, want.Time)
+	}
+	got.Time = want.Time
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if vmi := got.VMIs[0].Object(); vmi.Name != "vm1" || vmi.UID != "uid-1" || vmi.Labels["app"] != "db" {
+		t.Errorf("unexpected object %+v", vmi.ObjectMeta)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("a corrupt checkpoint should not load")
+	}
+}
+
+func TestInPools(t *testing.T) {
+	c := &Checkpoint{Cidrs: map[int][]string{100: {"10.0.0.0/24"}}, OptedOut: []string{"02:00:00:00:00:01"}}
+	if !c.InPools(100, "10.0.0.2") || c.InPools(100, "10.0.1.2") || c.InPools(101, "10.0.0.2") {
+		t.Error("only the addresses of the pools of their vlan are in them")
+	}
+	if !c.IsOptedOut("02:00:00:00:00:01") || !c.IsOptedOut("02-00-00-00-00-01") || c.IsOptedOut("02:00:00:00:00:02") {
+		t.Error("unexpected opt-out")
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import "fmt"
+
+// Announcers, as named in the configuration.
+const (
+	// AnnouncerGarpRequest writes a gratuitous arp request per ipv4 address.
+	AnnouncerGarpRequest = "garp-request"
+	// AnnouncerGarpReply writes a gratuitous arp reply per ipv4 address.
+	AnnouncerGarpReply = "garp-reply"
+	// AnnouncerNA writes an unsolicited neighbor advertisement per ipv6
+	// address.
+	AnnouncerNA = "ipv6-na"
+	// AnnouncerRARP writes RARPBurst reverse arp requests per interface.
+	AnnouncerRARP = "rarp"
+	// AnnouncerTaggedGarpRequest writes the gratuitous arp requests with the
+	// vlan tag on the bond under the bridge rather than on the bridge.
+	AnnouncerTaggedGarpRequest = "tagged-garp-request"
+	// AnnouncerQMP has QEMU announce the guest through QMPSocket.
+	AnnouncerQMP = "qmp-announce-self"
+)
+
+var announcers = map[string]bool{
+	AnnouncerGarpRequest:       true,
+	AnnouncerGarpReply:         true,
+	AnnouncerNA:                true,
+	AnnouncerRARP:              true,
+	AnnouncerTaggedGarpRequest: true,
+	AnnouncerQMP:               true,
+}
+
+// AnnouncerPolicy picks the announcers of the interfaces on some vlans or of
+// the VMIs in some namespaces.
+type AnnouncerPolicy struct {
+	// Vlans and Namespaces select the interfaces the policy applies to, any
+	// when empty; a policy listing both applies where both match.
+	Vlans      []int    `json:"vlans,omitempty"`
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Announcers announce the selected interfaces, in this order.
+	Announcers []string `json:"announcers"`
+}
+
+func (p *AnnouncerPolicy) matches(vlan int, namespace string) bool {
+	if len(p.Vlans) > 0 && !containsInt(p.Vlans, vlan) {
+		return false
+	}
+	if len(p.Namespaces) > 0 && !containsString(p.Namespaces, namespace) {
+		return false
+	}
+	return true
+}
+
+// AnnouncersFor returns the announcers of an interface on vlan of a VMI in
+// namespace: those of the first policy that applies, else Announcers.
+func (c *Config) AnnouncersFor(vlan int, namespace string) []string {
+	for i := range c.AnnouncerPolicies {
+		if c.AnnouncerPolicies[i].matches(vlan, namespace) {
+			return c.AnnouncerPolicies[i].Announcers
+		}
+	}
+	return c.Announcers
+}
+
+func validateAnnouncers(field string, names []string) []error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, name := range names {
+		switch {
+		case !announcers[name]:
+			errs = append(errs, fmt.Errorf("%s: unknown announcer %q", field, name))
+		case seen[name]:
+			errs = append(errs, fmt.Errorf("%s: announcer %q is listed twice", field, name))
+		}
+		seen[name] = true
+	}
+	return errs
+}
+
+func (c *Config) validatePolicies() []error {
+	errs := validateAnnouncers("announcers", c.Announcers)
+	for i, p := range c.AnnouncerPolicies {
+		field := fmt.Sprintf("announcerPolicies[%d]", i)
+		if len(p.Vlans) == 0 && len(p.Namespaces) == 0 {
+			errs = append(errs, fmt.Errorf("%s: selects neither vlans nor namespaces", field))
+		}
+		for _, vlan := range p.Vlans {
+			if vlan < 1 || vlan > 4094 {
+				errs = append(errs, fmt.Errorf("%s: vlan %d is out of range [1, 4094]", field, vlan))
+			}
+		}
+		errs = append(errs, validateAnnouncers(field+".announcers", p.Announcers)...)
+	}
+	return errs
+}
+
+func containsInt(list []int, v int) bool {
+	for _, i := range list {
+		if i == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
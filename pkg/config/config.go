@@ -0,0 +1,359 @@
+package config
+
+import (
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Version is the configuration format this build understands.
+const Version = "v1alpha1"
+
+// Config holds everything the agent used to hard-code. The zero value is not
+// usable; start from Default.
+type Config struct {
+	Version string `json:"version"`
+	// Bonds are the host bonds whose failover triggers an announcement round.
+	Bonds []string `json:"bonds"`
+	// BridgePrefix is prepended to the vlan id to name the host bridge.
+	BridgePrefix string `json:"bridgePrefix"`
+	// Interfaces are the guest interface names to announce, all when empty.
+	Interfaces []string `json:"interfaces"`
+	// IPAMResyncPeriod is the resync period of the ipfixed informers.
+	IPAMResyncPeriod metav1.Duration `json:"ipamResyncPeriod"`
+	// VMIResyncPeriod is the minimum resync period of the VMI informers.
+	VMIResyncPeriod metav1.Duration `json:"vmiResyncPeriod"`
+	// SnapLen is the snapshot length of the pcap handles.
+	SnapLen int32 `json:"snapLen"`
+	// ShutdownTimeout bounds the failover round still running at shutdown.
+	ShutdownTimeout metav1.Duration `json:"shutdownTimeout"`
+	// MetricsAddress is where the prometheus metrics are served.
+	MetricsAddress string `json:"metricsAddress"`
+	// HealthAddress is where the probes and the status page are served.
+	HealthAddress string `json:"healthAddress"`
+	// EventQPS and EventBurst rate-limit the Kubernetes events recorded by
+	// the agent across all objects.
+	EventQPS   float64 `json:"eventQPS"`
+	EventBurst int     `json:"eventBurst"`
+	// StatusHistory is how many failover rounds the BridgeNodeStatus keeps.
+	StatusHistory int `json:"statusHistory"`
+	// StatusMinInterval is the least time between two BridgeNodeStatus
+	// writes; changes in between are folded into the next write.
+	StatusMinInterval metav1.Duration `json:"statusMinInterval"`
+	// StatusRefreshPeriod is how often the bonds and bridges are re-read
+	// when no round happens.
+	StatusRefreshPeriod metav1.Duration `json:"statusRefreshPeriod"`
+	// DryRun runs the rounds without writing any frame, logging what they
+	// would have sent instead.
+	DryRun bool `json:"dryRun"`
+	// StateDir is the host directory the agent keeps its state in across
+	// restarts; nothing is kept when empty.
+	StateDir string `json:"stateDir"`
+	// AnnounceOnFirstStart runs a round at startup when StateDir holds no
+	// state yet, as on the first start after installation.
+	AnnounceOnFirstStart bool `json:"announceOnFirstStart"`
+	// CheckpointInterval is how often the mapping of the local VMIs to the
+	// bridges they are announced on is saved in StateDir.
+	CheckpointInterval metav1.Duration `json:"checkpointInterval"`
+	// CheckpointMaxAge is the age past which a round no longer trusts the
+	// checkpoint, whose VMIs may have moved or gone since; 0 for no limit.
+	CheckpointMaxAge metav1.Duration `json:"checkpointMaxAge"`
+	// SyncWaitTimeout is how long a round waits for informers that have not
+	// synced before it falls back to the checkpoint.
+	SyncWaitTimeout metav1.Duration `json:"syncWaitTimeout"`
+	// Discovery sniffs arp on the bridges so that, with neither synced
+	// informers nor a checkpoint, a round still announces the mac and ip
+	// addresses found behind the bridge ports.
+	Discovery bool `json:"discovery"`
+	// RARPBurst is how many rarp frames announce the mac of every bridged
+	// interface in a round, as QEMU's announce_self does; none when 0.
+	RARPBurst int `json:"rarpBurst"`
+	// RARPInterval is the time between two rarp frames of a burst.
+	RARPInterval metav1.Duration `json:"rarpInterval"`
+	// QMPSocket finds the QMP socket of a VMI on the host, {namespace} and
+	// {name} standing for the VMI's and glob wildcards for the rest. When set,
+	// a round also has QEMU announce the guest with announce-self.
+	QMPSocket string `json:"qmpSocket"`
+	// QMPAnnounceRounds and QMPAnnounceStep are the rounds of announce-self
+	// and how much longer each waits than the one before.
+	QMPAnnounceRounds int             `json:"qmpAnnounceRounds"`
+	QMPAnnounceStep   metav1.Duration `json:"qmpAnnounceStep"`
+	// Announcers announce the interfaces no policy of AnnouncerPolicies
+	// applies to, in this order.
+	Announcers []string `json:"announcers"`
+	// AnnouncerPolicies pick other announcers for some vlans or namespaces;
+	// the first that applies to an interface wins.
+	AnnouncerPolicies []AnnouncerPolicy `json:"announcerPolicies"`
+	// VerifyOwnership refuses to announce an address unless an IPRecorder
+	// entry gives it to the VMI, or to its virt-launcher pod as for standalone
+	// VMIs, and it lies in the cidr of the entry's IPPool, so a guest cannot
+	// have the host announce addresses it made up. The addresses a round
+	// learns from discovery must lie in the pool cidrs of their vlan. As the
+	// check runs before the IPPool fallback of the vlan lookup, an address
+	// missing from the IPRecorders is refused rather than placed by its
+	// IPPool; turn it off to have that fallback.
+	VerifyOwnership bool `json:"verifyOwnership"`
+	// ConflictCheck probes the ipv4 addresses of a round before announcing
+	// them, as RFC 5227 does, and leaves out those another mac answers for
+	// within ConflictWait.
+	ConflictCheck bool            `json:"conflictCheck"`
+	ConflictWait  metav1.Duration `json:"conflictWait"`
+	// GatewayCheck has a round ask the gateway of every vlan it announced on
+	// for its mac and expect the reply on the active slave of the bond,
+	// within GatewayWait. The vlans whose gateway stays silent are announced
+	// again, up to GatewayRetries more rounds.
+	GatewayCheck   bool            `json:"gatewayCheck"`
+	GatewayWait    metav1.Duration `json:"gatewayWait"`
+	GatewayRetries int             `json:"gatewayRetries"`
+	// TrafficCheck samples the unicast packets the bridge port of every VMI
+	// of a round receives from it, as IFLA_STATS64 counts them. The VMIs
+	// sending none within TrafficWindow are announced again, the window
+	// doubling each time, up to TrafficRetries times; the report lists those
+	// that never recover.
+	TrafficCheck   bool            `json:"trafficCheck"`
+	TrafficWindow  metav1.Duration `json:"trafficWindow"`
+	TrafficRetries int             `json:"trafficRetries"`
+	// GatewayWatch sniffs the vrrp advertisements and the arp of the
+	// gateways reaching every vlan bridge from its bond, and has a round
+	// announce the vlan whose vrrp master or gateway mac changes, at most
+	// once per GatewayHoldoff.
+	GatewayWatch   bool            `json:"gatewayWatch"`
+	GatewayHoldoff metav1.Duration `json:"gatewayHoldoff"`
+}
+
+// Default returns the configuration matching the agent's historic behaviour.
+func Default() *Config {
+	return &Config{
+		Version:             Version,
+		Bonds:               []string{"bond0"},
+		BridgePrefix:        "vlan",
+		Interfaces:          []string{"eth0"},
+		IPAMResyncPeriod:    metav1.Duration{Duration: 30 * time.Second},
+		VMIResyncPeriod:     metav1.Duration{Duration: 12 * time.Hour},
+		SnapLen:             65536,
+		ShutdownTimeout:     metav1.Duration{Duration: 10 * time.Second},
+		MetricsAddress:      ":9495",
+		HealthAddress:       ":9496",
+		EventQPS:            1,
+		EventBurst:          50,
+		StatusHistory:       10,
+		StatusMinInterval:   metav1.Duration{Duration: 5 * time.Second},
+		StatusRefreshPeriod: metav1.Duration{Duration: time.Minute},
+		StateDir:            "/var/lib/habridge",
+		CheckpointInterval:  metav1.Duration{Duration: 30 * time.Second},
+		CheckpointMaxAge:    metav1.Duration{Duration: 24 * time.Hour},
+		SyncWaitTimeout:     metav1.Duration{Duration: 5 * time.Second},
+		RARPBurst:           5,
+		RARPInterval:        metav1.Duration{Duration: 50 * time.Millisecond},
+		QMPAnnounceRounds:   5,
+		QMPAnnounceStep:     metav1.Duration{Duration: 100 * time.Millisecond},
+		Announcers:          []string{AnnouncerGarpRequest, AnnouncerRARP, AnnouncerQMP},
+		VerifyOwnership:     true,
+		ConflictWait:        metav1.Duration{Duration: 200 * time.Millisecond},
+		GatewayWait:         metav1.Duration{Duration: 500 * time.Millisecond},
+		GatewayRetries:      1,
+		TrafficWindow:       metav1.Duration{Duration: 2 * time.Second},
+		TrafficRetries:      3,
+		GatewayHoldoff:      metav1.Duration{Duration: 5 * time.Second},
+	}
+}
+
+// Validate reports every invalid field at once.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Version != Version {
+		errs = append(errs, fmt.Errorf("unsupported version %q, want %q", c.Version, Version))
+	}
+	if len(c.Bonds) == 0 {
+		errs = append(errs, fmt.Errorf("bonds: at least one bond is required"))
+	}
+	for _, bond := range c.Bonds {
+		if !validLinkName(bond) {
+			errs = append(errs, fmt.Errorf("bonds: invalid link name %q", bond))
+		}
+	}
+	if c.BridgePrefix == "" || !validLinkName(c.BridgePrefix+"4094") {
+		errs = append(errs, fmt.Errorf("bridgePrefix: %q does not give valid bridge names", c.BridgePrefix))
+	}
+	for _, name := range c.Interfaces {
+		if name == "" {
+			errs = append(errs, fmt.Errorf("interfaces: empty interface name"))
+		}
+	}
+	if c.IPAMResyncPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("ipamResyncPeriod: must be positive"))
+	}
+	if c.VMIResyncPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("vmiResyncPeriod: must be positive"))
+	}
+	if c.SnapLen < 64 || c.SnapLen > 262144 {
+		errs = append(errs, fmt.Errorf("snapLen: %d is out of range [64, 262144]", c.SnapLen))
+	}
+	if c.ShutdownTimeout.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("shutdownTimeout: must be positive"))
+	}
+	if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+		errs = append(errs, fmt.Errorf("metricsAddress: %v", err))
+	}
+	if _, _, err := net.SplitHostPort(c.HealthAddress); err != nil {
+		errs = append(errs, fmt.Errorf("healthAddress: %v", err))
+	}
+	if c.EventQPS <= 0 {
+		errs = append(errs, fmt.Errorf("eventQPS: must be positive"))
+	}
+	if c.EventBurst < 1 {
+		errs = append(errs, fmt.Errorf("eventBurst: must be at least 1"))
+	}
+	if c.StatusHistory < 0 {
+		errs = append(errs, fmt.Errorf("statusHistory: must not be negative"))
+	}
+	if c.StatusMinInterval.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("statusMinInterval: must be positive"))
+	}
+	if c.StatusRefreshPeriod.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("statusRefreshPeriod: must be positive"))
+	}
+	if c.CheckpointInterval.Duration <= 0 {
+		errs = append(errs, fmt.Errorf("checkpointInterval: must be positive"))
+	}
+	if c.CheckpointMaxAge.Duration < 0 {
+		errs = append(errs, fmt.Errorf("checkpointMaxAge: must not be negative"))
+	}
+	if c.SyncWaitTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("syncWaitTimeout: must not be negative"))
+	}
+	if c.RARPBurst < 0 {
+		errs = append(errs, fmt.Errorf("rarpBurst: must not be negative"))
+	}
+	if c.RARPInterval.Duration < 0 {
+		errs = append(errs, fmt.Errorf("rarpInterval: must not be negative"))
+	}
+	if c.QMPSocket != "" && !filepath.IsAbs(c.QMPSocket) {
+		errs = append(errs, fmt.Errorf("qmpSocket: %q is not an absolute path", c.QMPSocket))
+	}
+	if _, err := filepath.Match(c.QMPSocket, ""); err != nil {
+		errs = append(errs, fmt.Errorf("qmpSocket: %v", err))
+	}
+	if c.QMPAnnounceRounds < 1 {
+		errs = append(errs, fmt.Errorf("qmpAnnounceRounds: must be at least 1"))
+	}
+	if c.QMPAnnounceStep.Duration < time.Millisecond {
+		errs = append(errs, fmt.Errorf("qmpAnnounceStep: must be at least 1ms"))
+	}
+	if c.ConflictWait.Duration < time.Millisecond || c.ConflictWait.Duration > 5*time.Second {
+		errs = append(errs, fmt.Errorf("conflictWait: must be between 1ms and 5s"))
+	}
+	if c.GatewayWait.Duration < time.Millisecond || c.GatewayWait.Duration > 10*time.Second {
+		errs = append(errs, fmt.Errorf("gatewayWait: must be between 1ms and 10s"))
+	}
+	if c.GatewayRetries < 0 || c.GatewayRetries > 5 {
+		errs = append(errs, fmt.Errorf("gatewayRetries: %d is out of range [0, 5]", c.GatewayRetries))
+	}
+	if c.TrafficWindow.Duration < 100*time.Millisecond || c.TrafficWindow.Duration > time.Minute {
+		errs = append(errs, fmt.Errorf("trafficWindow: must be between 100ms and 1m"))
+	}
+	if c.TrafficRetries < 0 || c.TrafficRetries > 10 {
+		errs = append(errs, fmt.Errorf("trafficRetries: %d is out of range [0, 10]", c.TrafficRetries))
+	}
+	if c.GatewayHoldoff.Duration < 0 {
+		errs = append(errs, fmt.Errorf("gatewayHoldoff: must not be negative"))
+	}
+	errs = append(errs, c.validatePolicies()...)
+	if c.StateDir != "" && !filepath.IsAbs(c.StateDir) {
+		errs = append(errs, fmt.Errorf("stateDir: %q is not an absolute path", c.StateDir))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// RestartRequired lists the fields that differ from old but are only read
+// at startup, when the informers and servers are created.
+func (c *Config) RestartRequired(old *Config) []string {
+	var fields []string
+	if c.IPAMResyncPeriod != old.IPAMResyncPeriod {
+		fields = append(fields, "ipamResyncPeriod")
+	}
+	if c.VMIResyncPeriod != old.VMIResyncPeriod {
+		fields = append(fields, "vmiResyncPeriod")
+	}
+	if c.MetricsAddress != old.MetricsAddress {
+		fields = append(fields, "metricsAddress")
+	}
+	if c.HealthAddress != old.HealthAddress {
+		fields = append(fields, "healthAddress")
+	}
+	if c.EventQPS != old.EventQPS {
+		fields = append(fields, "eventQPS")
+	}
+	if c.EventBurst != old.EventBurst {
+		fields = append(fields, "eventBurst")
+	}
+	if c.StateDir != old.StateDir {
+		fields = append(fields, "stateDir")
+	}
+	return fields
+}
+
+// KeepStartupFields copies the fields listed by RestartRequired from old, so
+// a reloaded configuration describes what is actually running.
+func (c *Config) KeepStartupFields(old *Config) {
+	c.IPAMResyncPeriod = old.IPAMResyncPeriod
+	c.VMIResyncPeriod = old.VMIResyncPeriod
+	c.MetricsAddress = old.MetricsAddress
+	c.HealthAddress = old.HealthAddress
+	c.EventQPS = old.EventQPS
+	c.EventBurst = old.EventBurst
+	c.StateDir = old.StateDir
+}
+
+// BridgeName returns the host bridge carrying vlan.
+func (c *Config) BridgeName(vlan int) string {
+	return fmt.Sprint(c.BridgePrefix, vlan)
+}
+
+// IsBond reports whether name is one of the monitored bonds.
+func (c *Config) IsBond(name string) bool {
+	for _, bond := range c.Bonds {
+		if bond == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AnnounceInterface reports whether the guest interface name is announced.
+func (c *Config) AnnounceInterface(name string) bool {
+	if len(c.Interfaces) == 0 {
+		return true
+	}
+	for _, intf := range c.Interfaces {
+		if intf == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validLinkName(name string) bool {
+	return name != "" && len(name) < 16 && !strings.ContainsAny(name, "/ \t\n:")
+}
+
+var current atomic.Value
+
+func init() {
+	current.Store(Default())
+}
+
+// Get returns the configuration in effect. Callers must not modify it.
+func Get() *Config {
+	return current.Load().(*Config)
+}
+
+// Set atomically replaces the configuration in effect.
+func Set(c *Config) {
+	current.Store(c)
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDefaultIsValid(t *testing.T) {
+	if err := Default().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.Version = "v0"
+	c.Bonds = []string{"bond0", "a-name-longer-than-ifnamsiz"}
+	c.SnapLen = 10
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"version", "bonds", "snapLen"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "habridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.yaml")
+	data := "version: v1alpha1\nbonds: [bond0, bond1]\nbridgePrefix: br\nshutdownTimeout: 5s\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := NewLoader(fs)
+	if err := fs.Parse([]string{"-config", path, "-bridge-prefix", "vl", "-snaplen", "1500"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IsBond("bond1") || c.BridgeName(100) != "vl100" || c.SnapLen != 1500 {
+		t.Fatalf("unexpected configuration %+v", c)
+	}
+	if c.ShutdownTimeout.Duration != 5*time.Second || !c.AnnounceInterface("eth0") || c.AnnounceInterface("eth1") {
+		t.Fatalf("unexpected configuration %+v", c)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("version: v1alpha1\nunknown: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Load(); err == nil {
+		t.Fatal("expected unknown field to be rejected")
+	}
+	if string(l.last) != "version: v1alpha1\nunknown: true\n" {
+		t.Errorf("the rejected file should count as seen, or every poll reloads it: %q", l.last)
+	}
+}
+
+func TestAnnouncersFor(t *testing.T) {
+	c := Default()
+	c.AnnouncerPolicies = []AnnouncerPolicy{
+		{Vlans: []int{100}, Namespaces: []string{"prod"}, Announcers: []string{AnnouncerQMP}},
+		{Vlans: []int{100, 200}, Announcers: []string{AnnouncerGarpReply, AnnouncerNA}},
+		{Namespaces: []string{"prod"}, Announcers: []string{AnnouncerTaggedGarpRequest}},
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		vlan      int
+		namespace string
+		want      []string
+	}{
+		{100, "prod", []string{AnnouncerQMP}},
+		{100, "dev", []string{AnnouncerGarpReply, AnnouncerNA}},
+		{300, "prod", []string{AnnouncerTaggedGarpRequest}},
+		{300, "dev", c.Announcers},
+	} {
+		if got := c.AnnouncersFor(tc.vlan, tc.namespace); strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("AnnouncersFor(%d, %s) = %v, want %v", tc.vlan, tc.namespace, got, tc.want)
+		}
+	}
+
+	c.Announcers = []string{AnnouncerRARP, "smoke-signals", AnnouncerRARP}
+	c.AnnouncerPolicies = []AnnouncerPolicy{{Announcers: []string{AnnouncerRARP}}, {Vlans: []int{5000}}}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"unknown announcer", "listed twice", "neither vlans nor namespaces", "out of range"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+}
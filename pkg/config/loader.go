@@ -0,0 +1,271 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/klog/v2"
+	"os"
+	"sigs.k8s.io/yaml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Loader builds the configuration from defaults, an optional file and the
+// flags given on the command line, in increasing order of precedence.
+type Loader struct {
+	path  string
+	flags *flag.FlagSet
+	// values holds what the flags parsed into; only flags actually set on
+	// the command line are copied over the file.
+	values Config
+	// last is the file content last loaded, valid or not, so that a broken
+	// file is only reported once rather than at every poll.
+	last []byte
+}
+
+// NewLoader registers the configuration flags on fs.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{flags: fs}
+	d := Default()
+	fs.StringVar(&l.path, "config", "", "path of the habridge configuration file")
+	fs.Var(newListValue(d.Bonds, &l.values.Bonds), "bonds", "comma separated bonds to monitor")
+	fs.StringVar(&l.values.BridgePrefix, "bridge-prefix", d.BridgePrefix, "prefix of the per-vlan host bridges")
+	fs.Var(newListValue(d.Interfaces, &l.values.Interfaces), "interfaces", "comma separated guest interfaces to announce, empty for all")
+	fs.DurationVar(&l.values.IPAMResyncPeriod.Duration, "ipam-resync-period", d.IPAMResyncPeriod.Duration, "resync period of the ipfixed informers")
+	fs.DurationVar(&l.values.VMIResyncPeriod.Duration, "vmi-resync-period", d.VMIResyncPeriod.Duration, "minimum resync period of the vmi informers")
+	l.values.SnapLen = d.SnapLen
+	fs.Var(&int32Value{&l.values.SnapLen}, "snaplen", "snapshot length of the pcap handles")
+	fs.DurationVar(&l.values.ShutdownTimeout.Duration, "shutdown-timeout", d.ShutdownTimeout.Duration, "how long a running failover round may take after a shutdown signal")
+	fs.StringVar(&l.values.MetricsAddress, "metrics-address", d.MetricsAddress, "address to serve prometheus metrics on")
+	fs.StringVar(&l.values.HealthAddress, "health-address", d.HealthAddress, "address to serve the health probes and status page on")
+	fs.Float64Var(&l.values.EventQPS, "event-qps", d.EventQPS, "events per second the agent may record")
+	fs.IntVar(&l.values.EventBurst, "event-burst", d.EventBurst, "burst of events the agent may record")
+	fs.IntVar(&l.values.StatusHistory, "status-history", d.StatusHistory, "number of failover rounds kept in the BridgeNodeStatus")
+	fs.DurationVar(&l.values.StatusMinInterval.Duration, "status-min-interval", d.StatusMinInterval.Duration, "least time between two BridgeNodeStatus writes")
+	fs.DurationVar(&l.values.StatusRefreshPeriod.Duration, "status-refresh-period", d.StatusRefreshPeriod.Duration, "how often the BridgeNodeStatus is refreshed without failover")
+	fs.BoolVar(&l.values.DryRun, "dry-run", d.DryRun, "run the failover rounds without writing any frame")
+	fs.StringVar(&l.values.StateDir, "state-dir", d.StateDir, "host directory the agent keeps its state in across restarts, empty for none")
+	fs.BoolVar(&l.values.AnnounceOnFirstStart, "announce-on-first-start", d.AnnounceOnFirstStart, "announce every vmi when the agent starts without prior state")
+	fs.DurationVar(&l.values.CheckpointInterval.Duration, "checkpoint-interval", d.CheckpointInterval.Duration, "how often the local vmi mapping is checkpointed")
+	fs.DurationVar(&l.values.CheckpointMaxAge.Duration, "checkpoint-max-age", d.CheckpointMaxAge.Duration, "age past which the checkpoint is not announced from, 0 for no limit")
+	fs.DurationVar(&l.values.SyncWaitTimeout.Duration, "sync-wait-timeout", d.SyncWaitTimeout.Duration, "how long a round waits for unsynced informers before using the checkpoint")
+	fs.BoolVar(&l.values.Discovery, "discovery", d.Discovery, "learn vm addresses from the bridges for rounds run without api data")
+	fs.IntVar(&l.values.RARPBurst, "rarp-burst", d.RARPBurst, "rarp frames announcing each bridged interface mac per round, 0 for none")
+	fs.DurationVar(&l.values.RARPInterval.Duration, "rarp-interval", d.RARPInterval.Duration, "time between two rarp frames of a burst")
+	fs.StringVar(&l.values.QMPSocket, "qmp-socket", d.QMPSocket, "glob of the qmp socket of a vmi, with {namespace} and {name}, to run announce-self; empty for none")
+	fs.Var(newListValue(d.Announcers, &l.values.Announcers), "announcers", "comma separated announcers of the interfaces no policy applies to, in order")
+	fs.IntVar(&l.values.QMPAnnounceRounds, "qmp-announce-rounds", d.QMPAnnounceRounds, "rounds of announce-self")
+	fs.DurationVar(&l.values.QMPAnnounceStep.Duration, "qmp-announce-step", d.QMPAnnounceStep.Duration, "how much longer each announce-self round waits than the one before")
+	fs.BoolVar(&l.values.VerifyOwnership, "verify-ownership", d.VerifyOwnership, "announce only the addresses ipam gives to the vmi reporting them")
+	fs.BoolVar(&l.values.ConflictCheck, "conflict-check", d.ConflictCheck, "probe the addresses of a round with arp and skip those another mac answers for")
+	fs.DurationVar(&l.values.ConflictWait.Duration, "conflict-wait", d.ConflictWait.Duration, "how long the conflict check listens for answers to its probes")
+	fs.BoolVar(&l.values.GatewayCheck, "gateway-check", d.GatewayCheck, "after a round, arp the gateway of each vlan and expect the reply on the active slave")
+	fs.DurationVar(&l.values.GatewayWait.Duration, "gateway-wait", d.GatewayWait.Duration, "how long the gateway check waits for the reply of a gateway")
+	fs.IntVar(&l.values.GatewayRetries, "gateway-retries", d.GatewayRetries, "rounds announcing again the vlans whose gateway did not reply")
+	fs.BoolVar(&l.values.TrafficCheck, "traffic-check", d.TrafficCheck, "after a round, announce again the vmis whose bridge port receives no unicast from them")
+	fs.DurationVar(&l.values.TrafficWindow.Duration, "traffic-window", d.TrafficWindow.Duration, "how long the traffic check first waits for packets from each vmi, doubled at each retry")
+	fs.IntVar(&l.values.TrafficRetries, "traffic-retries", d.TrafficRetries, "times the vmis receiving no packets are announced again")
+	fs.BoolVar(&l.values.GatewayWatch, "gateway-watch", d.GatewayWatch, "announce the vlan whose vrrp master or gateway mac changes")
+	fs.DurationVar(&l.values.GatewayHoldoff.Duration, "gateway-holdoff", d.GatewayHoldoff.Duration, "least time between two rounds announcing a vlan for its gateway changing")
+	return l
+}
+
+// Path returns the configuration file, empty when only flags are used.
+func (l *Loader) Path() string {
+	return l.path
+}
+
+// Load builds and validates a fresh configuration.
+func (l *Loader) Load() (*Config, error) {
+	c := Default()
+	if l.path != "" {
+		data, err := ioutil.ReadFile(l.path)
+		if err != nil {
+			return nil, err
+		}
+		l.last = data
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", l.path, err)
+		}
+	}
+	l.flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "bonds":
+			c.Bonds = l.values.Bonds
+		case "bridge-prefix":
+			c.BridgePrefix = l.values.BridgePrefix
+		case "interfaces":
+			c.Interfaces = l.values.Interfaces
+		case "ipam-resync-period":
+			c.IPAMResyncPeriod = l.values.IPAMResyncPeriod
+		case "vmi-resync-period":
+			c.VMIResyncPeriod = l.values.VMIResyncPeriod
+		case "snaplen":
+			c.SnapLen = l.values.SnapLen
+		case "shutdown-timeout":
+			c.ShutdownTimeout = l.values.ShutdownTimeout
+		case "metrics-address":
+			c.MetricsAddress = l.values.MetricsAddress
+		case "health-address":
+			c.HealthAddress = l.values.HealthAddress
+		case "event-qps":
+			c.EventQPS = l.values.EventQPS
+		case "event-burst":
+			c.EventBurst = l.values.EventBurst
+		case "status-history":
+			c.StatusHistory = l.values.StatusHistory
+		case "status-min-interval":
+			c.StatusMinInterval = l.values.StatusMinInterval
+		case "status-refresh-period":
+			c.StatusRefreshPeriod = l.values.StatusRefreshPeriod
+		case "dry-run":
+			c.DryRun = l.values.DryRun
+		case "state-dir":
+			c.StateDir = l.values.StateDir
+		case "announce-on-first-start":
+			c.AnnounceOnFirstStart = l.values.AnnounceOnFirstStart
+		case "checkpoint-interval":
+			c.CheckpointInterval = l.values.CheckpointInterval
+		case "checkpoint-max-age":
+			c.CheckpointMaxAge = l.values.CheckpointMaxAge
+		case "sync-wait-timeout":
+			c.SyncWaitTimeout = l.values.SyncWaitTimeout
+		case "discovery":
+			c.Discovery = l.values.Discovery
+		case "rarp-burst":
+			c.RARPBurst = l.values.RARPBurst
+		case "rarp-interval":
+			c.RARPInterval = l.values.RARPInterval
+		case "qmp-socket":
+			c.QMPSocket = l.values.QMPSocket
+		case "announcers":
+			c.Announcers = l.values.Announcers
+		case "qmp-announce-rounds":
+			c.QMPAnnounceRounds = l.values.QMPAnnounceRounds
+		case "qmp-announce-step":
+			c.QMPAnnounceStep = l.values.QMPAnnounceStep
+		case "verify-ownership":
+			c.VerifyOwnership = l.values.VerifyOwnership
+		case "conflict-check":
+			c.ConflictCheck = l.values.ConflictCheck
+		case "conflict-wait":
+			c.ConflictWait = l.values.ConflictWait
+		case "gateway-check":
+			c.GatewayCheck = l.values.GatewayCheck
+		case "gateway-wait":
+			c.GatewayWait = l.values.GatewayWait
+		case "gateway-retries":
+			c.GatewayRetries = l.values.GatewayRetries
+		case "traffic-check":
+			c.TrafficCheck = l.values.TrafficCheck
+		case "traffic-window":
+			c.TrafficWindow = l.values.TrafficWindow
+		case "traffic-retries":
+			c.TrafficRetries = l.values.TrafficRetries
+		case "gateway-watch":
+			c.GatewayWatch = l.values.GatewayWatch
+		case "gateway-holdoff":
+			c.GatewayHoldoff = l.values.GatewayHoldoff
+		}
+	})
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	return c, nil
+}
+
+// Watch reloads the configuration when reload fires, as SIGHUP does, or when
+// the file content changes, as it does when a mounted ConfigMap is updated.
+// An invalid configuration is logged and the one in effect is kept.
+func (l *Loader) Watch(ctx context.Context, reload <-chan os.Signal, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-reload:
+			klog.Infof("got %v, reload configuration", sig)
+			l.reload()
+		case <-ticker.C:
+			if l.path == "" {
+				continue
+			}
+			data, err := ioutil.ReadFile(l.path)
+			if err != nil {
+				klog.Errorf("read configuration %s: %v", l.path, err)
+				continue
+			}
+			if !bytes.Equal(data, l.last) {
+				klog.Infof("configuration %s changed, reload it", l.path)
+				l.reload()
+			}
+		}
+	}
+}
+
+func (l *Loader) reload() {
+	c, err := l.Load()
+	if err != nil {
+		klog.Errorf("keep current configuration: %v", err)
+		return
+	}
+	old := Get()
+	if fields := c.RestartRequired(old); len(fields) > 0 {
+		klog.Warningf("%s only take effect after restart", strings.Join(fields, ", "))
+		c.KeepStartupFields(old)
+	}
+	Set(c)
+	klog.Infof("configuration reloaded: %+v", *c)
+}
+
+// listValue is a comma separated flag.Value.
+type listValue struct {
+	target *[]string
+}
+
+func newListValue(def []string, target *[]string) *listValue {
+	*target = append([]string(nil), def...)
+	return &listValue{target: target}
+}
+
+func (v *listValue) String() string {
+	if v == nil || v.target == nil {
+		return ""
+	}
+	return strings.Join(*v.target, ",")
+}
+
+func (v *listValue) Set(s string) error {
+	*v.target = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*v.target = append(*v.target, item)
+		}
+	}
+	return nil
+}
+
+type int32Value struct {
+	target *int32
+}
+
+func (v *int32Value) String() string {
+	if v == nil || v.target == nil {
+		return ""
+	}
+	return fmt.Sprint(*v.target)
+}
+
+func (v *int32Value) Set(s string) error {
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return err
+	}
+	*v.target = int32(n)
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package conflict finds the addresses another host already uses before a
+// round announces them: like a host claiming an address by RFC 5227, it
+// probes each of them with arp on its bridge and listens briefly for an
+// answer from another mac. Announcing such an address would only flip the
+// arp caches of the vlan between the two owners.
+package conflict
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/garp"
+	"k8s.io/klog/v2"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Probe is an address to probe on a bridge for the mac announcing it.
+type Probe struct {
+	Bridge string
+	IP     string
+	MAC    string
+}
+
+// Conflict is a probed address another mac answered for.
+type Conflict struct {
+	Probe
+	// By is the mac that answered.
+	By string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("ip %s of %s is in use by %s on %s", c.IP, c.MAC, c.By, c.Bridge)
+}
+
+// openCapture opens bridge for the probes and their answers; tests replace
+// it.
+var openCapture = func(cfg *config.Config, bridge string) (garp.Capture, error) {
+	return garp.OpenCapture(bridge, cfg.SnapLen, "arp")
+}
+
+// Check probes the ipv4 addresses of probes, the bridges side by side, and
+// returns the conflicts found within cfg.ConflictWait. The bridges that
+// cannot be probed are reported in the error and their addresses assumed
+// free, so that a broken check never holds a round back.
+func Check(ctx context.Context, cfg *config.Config, probes []Probe) ([]Conflict, error) {
+	bridges := map[string][]Probe{}
+	for _, p := range probes {
+		if ip := net.ParseIP(p.IP); ip == nil || ip.To4() == nil {
+			continue
+		}
+		bridges[p.Bridge] = append(bridges[p.Bridge], p)
+	}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var conflicts []Conflict
+	var errs []string
+	for bridge, probes := range bridges {
+		wg.Add(1)
+		go func(bridge string, probes []Probe) {
+			defer wg.Done()
+			found, err := check(ctx, cfg, bridge, probes)
+			mu.Lock()
+			defer mu.Unlock()
+			conflicts = append(conflicts, found...)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", bridge, err))
+			}
+		}(bridge, probes)
+	}
+	wg.Wait()
+	sort.Slice(conflicts, func(i, j int) bool {
+		if conflicts[i].Bridge != conflicts[j].Bridge {
+			return conflicts[i].Bridge < conflicts[j].Bridge
+		}
+		return conflicts[i].IP < conflicts[j].IP
+	})
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return conflicts, fmt.Errorf("probe %v", errs)
+	}
+	return conflicts, nil
+}
+
+// check probes probes on bridge and listens for the answers.
+func check(ctx context.Context, cfg *config.Config, bridge string, probes []Probe) ([]Conflict, error) {
+	capture, err := openCapture(cfg, bridge)
+	if err != nil {
+		return nil, fmt.Errorf("open: %v", err)
+	}
+	defer capture.Close()
+	owners := map[string]Probe{}
+	for _, p := range probes {
+		ip, mac := net.ParseIP(p.IP), p.MAC
+		hw, err := net.ParseMAC(mac)
+		if err != nil {
+			continue
+		}
+		data, err := garp.NewArpProbe(ip, hw)
+		if err != nil {
+			return nil, err
+		}
+		if err := capture.WritePacketData(data); err != nil {
+			return nil, fmt.Errorf("write probe for %s: %v", p.IP, err)
+		}
+		p.MAC = hw.String()
+		owners[ip.To4().String()] = p
+	}
+	var conflicts []Conflict
+	found := map[string]bool{}
+	deadline := time.Now().Add(cfg.ConflictWait.Duration)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		data, _, err := capture.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil {
+			return conflicts, fmt.Errorf("read: %v", err)
+		}
+		packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.NoCopy)
+		arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+		if !ok {
+			continue
+		}
+		if c, ok := answer(arp, owners); ok && !found[c.IP] {
+			found[c.IP] = true
+			klog.Warning(c.String())
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts, nil
+}
+
+// answer tells whether arp is another mac than the owner's claiming one of
+// the probed addresses, by an answer to the probe or an arp of its own.
+func answer(arp *layers.ARP, owners map[string]Probe) (Conflict, bool) {
+	sender := net.IP(arp.SourceProtAddress)
+	mac := net.HardwareAddr(arp.SourceHwAddress)
+	if len(sender) != 4 || len(mac) != 6 {
+		return Conflict{}, false
+	}
+	p, ok := owners[sender.String()]
+	if !ok || mac.String() == p.MAC {
+		return Conflict{}, false
+	}
+	return Conflict{Probe: p, By: mac.String()}, true
+}
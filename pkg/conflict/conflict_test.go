@@ -0,0 +1,103 @@
+package conflict
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/garp"
+)
+
+// fakeCapture answers the probes written on it with the arp of answers,
+// which maps a probed address to the mac answering for it.
+type fakeCapture struct {
+	mu      sync.Mutex
+	answers map[string]string
+	queue   [][]byte
+	probes  []string
+}
+
+func (c *fakeCapture) WritePacketData(data []byte) error {
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	arp := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	ip := net.IP(arp.DstProtAddress)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.probes = append(c.probes, ip.String())
+	if mac, ok := c.answers[ip.String()]; ok {
+		hw, _ := net.ParseMAC(mac)
+		reply, err := garp.NewGratuitousReply(ip, hw)
+		if err != nil {
+			return err
+		}
+		c.queue = append(c.queue, reply)
+	}
+	return nil
+}
+
+func (c *fakeCapture) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		time.Sleep(time.Millisecond)
+		return nil, gopacket.CaptureInfo{}, pcap.NextErrorTimeoutExpired
+	}
+	data := c.queue[0]
+	c.queue = c.queue[1:]
+	return data, gopacket.CaptureInfo{}, nil
+}
+
+func (c *fakeCapture) Close() {}
+
+func TestCheck(t *testing.T) {
+	captures := map[string]*fakeCapture{
+		"vlan100": {answers: map[string]string{
+			// the guest answering for its own address is no conflict
+			"10.0.0.2": "02:00:00:00:00:01",
+			"10.0.0.3": "02:00:00:00:00:99",
+		}},
+		"vlan200": {answers: map[string]string{"10.0.1.2": "02:00:00:00:00:98"}},
+	}
+	saved := openCapture
+	defer func() { openCapture = saved }()
+	openCapture = func(cfg *config.Config, bridge string) (garp.Capture, error) {
+		if c, ok := captures[bridge]; ok {
+			return c, nil
+		}
+		return nil, errors.New("no such device")
+	}
+	cfg := config.Default()
+	cfg.ConflictWait.Duration = 20 * time.Millisecond
+	conflicts, err := Check(context.Background(), cfg, []Probe{
+		{Bridge: "vlan100", IP: "10.0.0.2", MAC: "02:00:00:00:00:01"},
+		{Bridge: "vlan100", IP: "10.0.0.3", MAC: "02:00:00:00:00:02"},
+		{Bridge: "vlan100", IP: "fd00::3", MAC: "02:00:00:00:00:02"},
+		{Bridge: "vlan200", IP: "10.0.1.2", MAC: "02:00:00:00:00:03"},
+		{Bridge: "vlan300", IP: "10.0.2.2", MAC: "02:00:00:00:00:04"},
+	})
+	if err == nil {
+		t.Error("the bridge that cannot be opened should be reported")
+	}
+	var got []string
+	for _, c := range conflicts {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"ip 10.0.0.3 of 02:00:00:00:00:02 is in use by 02:00:00:00:00:99 on vlan100",
+		"ip 10.0.1.2 of 02:00:00:00:00:03 is in use by 02:00:00:00:00:98 on vlan200",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("conflicts = %q, want %q", got, want)
+	}
+	if probes := captures["vlan100"].probes; !reflect.DeepEqual(probes, []string{"10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("only the ipv4 addresses should be probed, got %v", probes)
+	}
+}
@@ -0,0 +1,173 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"ha-bridge/pkg/checkpoint"
+	"ha-bridge/pkg/config"
+	"k8s.io/klog/v2"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// bridgeRefresh is how often the workers are matched with the bridges
+	// and the configuration, and the hints refreshed.
+	bridgeRefresh = 30 * time.Second
+	// readTimeout bounds each capture read so a sniffer notices ctx being
+	// cancelled on a quiet bridge.
+	readTimeout = time.Second
+	// learnedTTL is how long an address learned from arp is kept without
+	// being seen again.
+	learnedTTL = 24 * time.Hour
+	// maxLearnedIPs bounds the addresses kept per mac, so that a guest
+	// claiming address after address cannot grow the table without end.
+	maxLearnedIPs = 8
+)
+
+// table maps the mac addresses seen in arp traffic to the ip addresses they
+// claimed and when they last did. It only learns the addresses within the
+// IPPool cidrs its hints know for the vlan they are claimed on.
+type table struct {
+	mu    sync.Mutex
+	ips   map[string]map[string]time.Time
+	hints *checkpoint.Checkpoint
+}
+
+func newTable() *table {
+	return &table{ips: map[string]map[string]time.Time{}, hints: &checkpoint.Checkpoint{}}
+}
+
+// learned is filled by the sniffers started by Run.
+var learned = newTable()
+
+// setHints replaces the pool cidrs and opt-outs the table goes by.
+func (t *table) setHints(hints *checkpoint.Checkpoint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hints = hints
+}
+
+// getHints returns the pool cidrs and opt-outs the table goes by.
+func (t *table) getHints() *checkpoint.Checkpoint {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.hints
+}
+
+// learn records that mac claimed ip on vlan at, unless ip is outside the
+// pools of vlan. The oldest address of mac makes room past maxLearnedIPs.
+func (t *table) learn(vlan int, mac net.HardwareAddr, ip net.IP, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.hints.InPools(vlan, ip.String()) {
+		return
+	}
+	ips, ok := t.ips[mac.String()]
+	if !ok {
+		ips = map[string]time.Time{}
+		t.ips[mac.String()] = ips
+	}
+	ips[ip.String()] = at
+	for len(ips) > maxLearnedIPs {
+		oldest := ""
+		for ip, seen := range ips {
+			if oldest == "" || seen.Before(ips[oldest]) {
+				oldest = ip
+			}
+		}
+		delete(ips, oldest)
+	}
+}
+
+// prune forgets the addresses not claimed again within learnedTTL of now.
+func (t *table) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for mac, ips := range t.ips {
+		for ip, at := range ips {
+			if now.Sub(at) > learnedTTL {
+				delete(ips, ip)
+			}
+		}
+		if len(ips) == 0 {
+			delete(t.ips, mac)
+		}
+	}
+}
+
+// lookup returns the ip addresses mac claimed within learnedTTL of now.
+func (t *table) lookup(mac net.HardwareAddr, now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var result []string
+	for ip, at := range t.ips[mac.String()] {
+		if now.Sub(at) > learnedTTL {
+			delete(t.ips[mac.String()], ip)
+			continue
+		}
+		result = append(result, ip)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// learnARP records the sender of an arp packet seen on vlan. Probes, whose
+// sender ip is 0.0.0.0, claim nothing.
+func (t *table) learnARP(arp *layers.ARP, vlan int, at time.Time) {
+	mac, ip := net.HardwareAddr(arp.SourceHwAddress), net.IP(arp.SourceProtAddress)
+	if len(mac) != 6 || mac[0]&1 != 0 || len(ip) != 4 || ip.IsUnspecified() {
+		return
+	}
+	t.learn(vlan, mac, ip, at)
+}
+
+// Run sniffs the arp traffic of every vlan bridge while Discovery is enabled,
+// and refreshes the hints of what it learns, until ctx is done.
+func Run(ctx context.Context) {
+	go Supervise(ctx, "sniff arp", func(cfg *config.Config) bool { return cfg.Discovery }, sniff)
+	for {
+		if config.Get().Discovery {
+			learned.setHints(readHints())
+			learned.prune(time.Now())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bridgeRefresh):
+		}
+	}
+}
+
+// sniff learns the senders of the arp packets seen on the bridge of vlan
+// until ctx is done or the bridge goes away.
+func sniff(ctx context.Context, bridge string, vlan int) error {
+	handle, err := pcap.OpenLive(bridge, config.Get().SnapLen, false, readTimeout)
+	if err != nil {
+		return fmt.Errorf("open %s: %v", bridge, err)
+	}
+	defer handle.Close()
+	if err := handle.SetBPFFilter("arp"); err != nil {
+		return err
+	}
+	klog.Infof("learn vm addresses from arp on %s", bridge)
+	for ctx.Err() == nil {
+		data, ci, err := handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.NoCopy)
+		if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok {
+			learned.learnARP(arp, vlan, ci.Timestamp)
+		}
+	}
+	return nil
+}
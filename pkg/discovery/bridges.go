@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"ha-bridge/pkg/config"
+	"io/ioutil"
+	"k8s.io/klog/v2"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sysClassNet is where the kernel publishes the bridges.
+var sysClassNet = "/sys/class/net"
+
+// Supervise runs work on every vlan bridge while enabled says so for the
+// current configuration, until ctx is done. It starts work on the bridges
+// that appear, cancels it on those that go and starts it again after
+// bridgeRefresh when it fails; what describes the work in the logs.
+func Supervise(ctx context.Context, what string, enabled func(*config.Config) bool, work func(ctx context.Context, bridge string, vlan int) error) {
+	var mu sync.Mutex
+	workers := map[string]context.CancelFunc{}
+	for {
+		cfg := config.Get()
+		var bridges []string
+		if enabled(cfg) {
+			var err error
+			if bridges, err = listBridges(cfg.BridgePrefix); err != nil {
+				klog.Errorf("list bridges: %v", err)
+			}
+		}
+		wanted := map[string]bool{}
+		mu.Lock()
+		for _, bridge := range bridges {
+			wanted[bridge] = true
+			if _, ok := workers[bridge]; ok {
+				continue
+			}
+			vlan, _ := BridgeVlan(cfg.BridgePrefix, bridge)
+			workCtx, cancel := context.WithCancel(ctx)
+			workers[bridge] = cancel
+			go func(bridge string, vlan int) {
+				if err := work(workCtx, bridge, vlan); err != nil {
+					klog.Errorf("%s on %s: %v", what, bridge, err)
+				}
+				mu.Lock()
+				delete(workers, bridge)
+				mu.Unlock()
+			}(bridge, vlan)
+		}
+		for bridge, cancel := range workers {
+			if !wanted[bridge] {
+				cancel()
+			}
+		}
+		mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(bridgeRefresh):
+		}
+	}
+}
+
+// listBridges lists the bridges named prefix followed by a vlan id.
+func listBridges(prefix string) ([]string, error) {
+	links, err := ioutil.ReadDir(sysClassNet)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, link := range links {
+		if _, ok := BridgeVlan(prefix, link.Name()); !ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(sysClassNet, link.Name(), "bridge")); err == nil {
+			result = append(result, link.Name())
+		}
+	}
+	return result, nil
+}
+
+// UplinkPort returns the port of bridge that leads to a monitored bond, the
+// bond itself or one of its vlan subinterfaces.
+func UplinkPort(cfg *config.Config, bridge string) (string, error) {
+	ports, err := ioutil.ReadDir(filepath.Join(sysClassNet, bridge, "brif"))
+	if err != nil {
+		return "", err
+	}
+	isUplink := uplink(cfg)
+	for _, port := range ports {
+		if isUplink(port.Name()) {
+			return port.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no port of %s leads to a monitored bond", bridge)
+}
@@ -0,0 +1,130 @@
+// Package discovery finds the VMs of this node without any API: the bridge
+// forwarding database tells which mac addresses sit behind the tap ports of
+// each vlan bridge, and the arp traffic sniffed on the bridges which ip
+// addresses they use, within the IPPool cidrs of their vlan. It is the last
+// resort of a round when the informers have not synced and there is no
+// checkpoint.
+package discovery
+
+import (
+	"ha-bridge/pkg/checkpoint"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/plan"
+	"k8s.io/klog/v2"
+	"net"
+	"strings"
+	"time"
+)
+
+// readFDB dumps the bridge fdb; tests replace it.
+var readFDB = ReadFDB
+
+// readHints returns the pool cidrs and opt-outs discovery goes by: the cidrs
+// of the IPPools once their informer has synced, else those the saved
+// checkpoint recorded, and the opt-outs of the saved checkpoint; tests
+// replace it.
+var readHints = func() *checkpoint.Checkpoint {
+	hints := &checkpoint.Checkpoint{}
+	if path := checkpoint.Path(); path != "" {
+		saved, err := checkpoint.Load(path)
+		if err != nil {
+			klog.Errorf("load checkpoint for discovery: %v", err)
+		} else if saved != nil {
+			hints.Cidrs, hints.OptedOut = saved.Cidrs, saved.OptedOut
+		}
+	}
+	if ipam.PoolInformer != nil && ipam.PoolInformer.HasSynced() {
+		hints.Cidrs = ipam.VlanCidrs()
+	}
+	return hints
+}
+
+// Checkpoint returns what discovery knows of the VMIs of node as a
+// checkpoint, with one VMI per tap port named after the port. It leaves out
+// the ports of the interfaces opting out, and the addresses outside the pools
+// of their vlan, and records the cidrs it went by.
+func Checkpoint(cfg *config.Config, node string) (*checkpoint.Checkpoint, error) {
+	entries, err := readFDB(cfg.BridgePrefix, uplink(cfg))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	hints := learned.getHints()
+	c := &checkpoint.Checkpoint{Node: node, Time: now, VMIs: []checkpoint.VMI{}, Cidrs: hints.Cidrs, OptedOut: hints.OptedOut}
+	ports := map[string]int{}
+	for _, e := range entries {
+		if hints.IsOptedOut(e.MAC.String()) {
+			continue
+		}
+		var ips []string
+		for _, ip := range learned.lookup(e.MAC, now) {
+			if hints.InPools(e.Vlan, ip) {
+				ips = append(ips, ip)
+			}
+		}
+		target := plan.Target{
+			VMI:       e.Port,
+			Interface: e.Port,
+			MAC:       e.MAC.String(),
+			IPs:       ips,
+			Vlan:      e.Vlan,
+			Bridge:    e.Bridge,
+		}
+		i, ok := ports[e.Port]
+		if !ok {
+			i = len(c.VMIs)
+			ports[e.Port] = i
+			c.VMIs = append(c.VMIs, checkpoint.VMI{Name: e.Port})
+		}
+		c.VMIs[i].Targets = append(c.VMIs[i].Targets, target)
+	}
+	return c, nil
+}
+
+// Lookup returns the bridge lookup of the macs the vlan bridges have learned
+// on their vm ports, read once from the fdb.
+func Lookup(cfg *config.Config) (plan.BridgeLookup, error) {
+	entries, err := readFDB(cfg.BridgePrefix, uplink(cfg))
+	if err != nil {
+		return nil, err
+	}
+	macs := map[string]FDBEntry{}
+	for _, e := range entries {
+		macs[e.MAC.String()] = e
+	}
+	return func(mac string) (string, int, bool) {
+		if hw, err := net.ParseMAC(mac); err == nil {
+			mac = hw.String()
+		}
+		e, ok := macs[mac]
+		return e.Bridge, e.Vlan, ok
+	}, nil
+}
+
+// Ports returns the vm port of the vlan bridges behind which each mac was
+// learned, read once from the fdb.
+func Ports(cfg *config.Config) (map[string]string, error) {
+	entries, err := readFDB(cfg.BridgePrefix, uplink(cfg))
+	if err != nil {
+		return nil, err
+	}
+	ports := map[string]string{}
+	for _, e := range entries {
+		ports[e.MAC.String()] = e.Port
+	}
+	return ports, nil
+}
+
+// uplink tells the bond ports, and their vlan subinterfaces, from the vm
+// ports of the bridges.
+func uplink(cfg *config.Config) func(port string) bool {
+	return func(port string) bool {
+		for _, bond := range cfg.Bonds {
+			if port == bond || strings.HasPrefix(port, bond+".") {
+				return true
+			}
+		}
+		return false
+	}
+}
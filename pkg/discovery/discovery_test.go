@@ -0,0 +1,172 @@
+package discovery
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/google/gopacket/layers"
+	"ha-bridge/pkg/checkpoint"
+	"ha-bridge/pkg/config"
+)
+
+// neighMessage builds the RTM_NEWNEIGH message of a bridge fdb entry.
+func neighMessage(port, master int, state uint16, mac string) syscall.NetlinkMessage {
+	nd := ndmsg{Family: syscall.AF_BRIDGE, Index: int32(port), State: state}
+	data := append([]byte(nil), (*[sizeofNdmsg]byte)(unsafe.Pointer(&nd))[:]...)
+	attr := func(typ uint16, value []byte) {
+		a := syscall.RtAttr{Len: uint16(syscall.SizeofRtAttr + len(value)), Type: typ}
+		data = append(data, (*[syscall.SizeofRtAttr]byte)(unsafe.Pointer(&a))[:]...)
+		data = append(data, value...)
+		for len(data)%syscall.RTA_ALIGNTO != 0 {
+			data = append(data, 0)
+		}
+	}
+	hw, _ := net.ParseMAC(mac)
+	attr(ndaLladdr, hw)
+	m := uint32(master)
+	attr(ndaMaster, (*[4]byte)(unsafe.Pointer(&m))[:])
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: syscall.RTM_NEWNEIGH}, Data: data}
+}
+
+func TestParseFDB(t *testing.T) {
+	names := map[int]string{1: "vlan100", 2: "tap0", 3: "bond0.100", 4: "br-int", 5: "tap1"}
+	msgs := []syscall.NetlinkMessage{
+		neighMessage(2, 1, 0x02, "02:00:00:00:00:01"),
+		neighMessage(2, 1, nudPermanent, "fe:00:00:00:00:01"),
+		neighMessage(3, 1, 0x02, "00:11:22:33:44:55"),
+		neighMessage(5, 4, 0x02, "02:00:00:00:00:02"),
+		neighMessage(2, 1, 0x02, "01:00:5e:00:00:01"),
+	}
+	entries := parseFDB(msgs, names, "vlan", func(port string) bool { return port == "bond0.100" })
+	if len(entries) != 1 {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if e := entries[0]; e.Bridge != "vlan100" || e.Vlan != 100 || e.Port != "tap0" || e.MAC.String() != "02:00:00:00:00:01" {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
+
+func TestLearnARP(t *testing.T) {
+	tb := newTable()
+	tb.setHints(&checkpoint.Checkpoint{Cidrs: map[int][]string{100: {"10.0.0.0/16"}}})
+	now := time.Now()
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	arp := func(ip string) *layers.ARP {
+		return &layers.ARP{SourceHwAddress: mac, SourceProtAddress: net.ParseIP(ip).To4()}
+	}
+	tb.learnARP(arp("10.0.0.2"), 100, now)
+	tb.learnARP(arp("0.0.0.0"), 100, now)
+	tb.learnARP(arp("10.0.0.9"), 100, now.Add(-2*learnedTTL))
+	tb.learnARP(arp("10.1.0.2"), 100, now)
+	tb.learnARP(arp("10.0.0.3"), 200, now)
+	if ips := tb.lookup(mac, now); len(ips) != 1 || ips[0] != "10.0.0.2" {
+		t.Errorf("unexpected ips %v", ips)
+	}
+
+	for i := 0; i < 2*maxLearnedIPs; i++ {
+		tb.learnARP(arp(fmt.Sprintf("10.0.1.%d", i)), 100, now.Add(time.Duration(i)*time.Second))
+	}
+	ips := tb.lookup(mac, now)
+	if len(ips) != maxLearnedIPs || tb.ips[mac.String()][fmt.Sprintf("10.0.1.%d", maxLearnedIPs-1)] != (time.Time{}) {
+		t.Errorf("only the %d latest addresses should be kept: %v", maxLearnedIPs, ips)
+	}
+	tb.prune(now.Add(2 * learnedTTL))
+	if len(tb.ips) != 0 {
+		t.Errorf("the expired addresses should be pruned: %v", tb.ips)
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	other, _ := net.ParseMAC("02:00:00:00:00:02")
+	optedOut, _ := net.ParseMAC("02:00:00:00:00:03")
+	saved := learned
+	defer func() { learned = saved }()
+	learned = newTable()
+	learned.setHints(&checkpoint.Checkpoint{Cidrs: map[int][]string{100: {"10.0.0.0/24"}}, OptedOut: []string{optedOut.String()}})
+	learned.learn(100, mac, net.ParseIP("10.0.0.2").To4(), time.Now())
+	var uplinks []string
+	readFDB = func(prefix string, uplink func(string) bool) ([]FDBEntry, error) {
+		for _, port := range []string{"bond0", "bond0.100", "bond01", "tap0"} {
+			if uplink(port) {
+				uplinks = append(uplinks, port)
+			}
+		}
+		return []FDBEntry{
+			{Bridge: "vlan100", Vlan: 100, Port: "tap0", MAC: mac},
+			{Bridge: "vlan100", Vlan: 100, Port: "tap1", MAC: other},
+			{Bridge: "vlan100", Vlan: 100, Port: "tap2", MAC: optedOut},
+		}, nil
+	}
+	defer func() { readFDB = ReadFDB }()
+
+	c, err := Checkpoint(config.Default(), "node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uplinks) != 2 || uplinks[0] != "bond0" || uplinks[1] != "bond0.100" {
+		t.Errorf("unexpected uplinks %v", uplinks)
+	}
+	if c.Node != "node-a" || len(c.VMIs) != 2 || len(c.Cidrs[100]) != 1 {
+		t.Fatalf("unexpected checkpoint %+v", c)
+	}
+	if targets := c.VMIs[0].Targets; c.VMIs[0].Name != "tap0" || len(targets) != 1 || targets[0].Bridge != "vlan100" ||
+		len(targets[0].IPs) != 1 || targets[0].IPs[0] != "10.0.0.2" {
+		t.Errorf("unexpected vmi %+v", c.VMIs[0])
+	}
+	if targets := c.VMIs[1].Targets; len(targets) != 1 || len(targets[0].IPs) != 0 {
+		t.Errorf("an address never seen in arp should have no ip: %+v", c.VMIs[1])
+	}
+}
+
+func TestLookup(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	readFDB = func(prefix string, uplink func(string) bool) ([]FDBEntry, error) {
+		return []FDBEntry{{Bridge: "vlan100", Vlan: 100, Port: "tap0", MAC: mac}}, nil
+	}
+	defer func() { readFDB = ReadFDB }()
+
+	lookup, err := Lookup(config.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bridge, vlan, ok := lookup("02:00:00:00:00:01"); !ok || bridge != "vlan100" || vlan != 100 {
+		t.Errorf("lookup = %s, %d, %v", bridge, vlan, ok)
+	}
+	if _, _, ok := lookup("02-00-00-00-00-01"); !ok {
+		t.Error("lookup should accept any mac notation")
+	}
+	if _, _, ok := lookup("02:00:00:00:00:02"); ok {
+		t.Error("lookup found an unknown mac")
+	}
+}
+
+func TestUplinkPort(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := sysClassNet
+	defer func() { sysClassNet = saved }()
+	sysClassNet = dir
+	for _, path := range []string{"vlan100/brif/vnet0", "vlan100/brif/bond0.100", "vlan200/brif/vnet1"} {
+		if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := config.Default()
+	if port, err := UplinkPort(cfg, "vlan100"); err != nil || port != "bond0.100" {
+		t.Errorf("UplinkPort(vlan100) = %q, %v, want bond0.100", port, err)
+	}
+	if _, err := UplinkPort(cfg, "vlan200"); err == nil {
+		t.Error("a bridge without a bond port should have no uplink")
+	}
+}
@@ -0,0 +1,131 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// Neighbour attributes and states of linux/neighbour.h that syscall lacks.
+const (
+	ndaLladdr    = 2
+	ndaMaster    = 9
+	nudPermanent = 0x80
+)
+
+// ndmsg is struct ndmsg of linux/neighbour.h.
+type ndmsg struct {
+	Family uint8
+	Pad1   uint8
+	Pad2   uint16
+	Index  int32
+	State  uint16
+	Flags  uint8
+	Type   uint8
+}
+
+const sizeofNdmsg = int(unsafe.Sizeof(ndmsg{}))
+
+// FDBEntry is a mac address a vlan bridge learned on one of its ports.
+type FDBEntry struct {
+	Bridge string
+	Vlan   int
+	Port   string
+	MAC    net.HardwareAddr
+}
+
+// ReadFDB dumps the forwarding database of the bridges named prefix followed
+// by a vlan id, keeping the unicast addresses learned on the ports for which
+// uplink is false.
+func ReadFDB(prefix string, uplink func(port string) bool) ([]FDBEntry, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_BRIDGE)
+	if err != nil {
+		return nil, fmt.Errorf("dump bridge fdb: %v", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse bridge fdb: %v", err)
+	}
+	names := map[int]string{}
+	links, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		names[link.Index] = link.Name
+	}
+	return parseFDB(msgs, names, prefix, uplink), nil
+}
+
+// parseFDB turns the RTM_NEWNEIGH messages of a bridge fdb dump into entries,
+// naming the links after names.
+func parseFDB(msgs []syscall.NetlinkMessage, names map[int]string, prefix string, uplink func(port string) bool) []FDBEntry {
+	var result []FDBEntry
+	for _, m := range msgs {
+		if m.Header.Type != syscall.RTM_NEWNEIGH || len(m.Data) < sizeofNdmsg {
+			continue
+		}
+		nd := (*ndmsg)(unsafe.Pointer(&m.Data[0]))
+		// permanent entries are the addresses of the ports themselves
+		if nd.Family != syscall.AF_BRIDGE || nd.State&nudPermanent != 0 {
+			continue
+		}
+		var mac net.HardwareAddr
+		master := -1
+		for _, attr := range parseAttrs(m.Data[sizeofNdmsg:]) {
+			switch attr.Attr.Type {
+			case ndaLladdr:
+				mac = net.HardwareAddr(attr.Value)
+			case ndaMaster:
+				if len(attr.Value) >= 4 {
+					master = int(*(*uint32)(unsafe.Pointer(&attr.Value[0])))
+				}
+			}
+		}
+		if len(mac) != 6 || mac[0]&1 != 0 {
+			continue
+		}
+		bridge, port := names[master], names[int(nd.Index)]
+		vlan, ok := BridgeVlan(prefix, bridge)
+		if !ok || port == "" || uplink(port) {
+			continue
+		}
+		result = append(result, FDBEntry{Bridge: bridge, Vlan: vlan, Port: port, MAC: mac})
+	}
+	return result
+}
+
+// parseAttrs splits b into route attributes; syscall.ParseNetlinkRouteAttr
+// refuses neighbour messages.
+func parseAttrs(b []byte) []syscall.NetlinkRouteAttr {
+	var attrs []syscall.NetlinkRouteAttr
+	for len(b) >= syscall.SizeofRtAttr {
+		a := (*syscall.RtAttr)(unsafe.Pointer(&b[0]))
+		if int(a.Len) < syscall.SizeofRtAttr || int(a.Len) > len(b) {
+			break
+		}
+		attrs = append(attrs, syscall.NetlinkRouteAttr{Attr: *a, Value: b[syscall.SizeofRtAttr:a.Len]})
+		b = b[rtaAlign(int(a.Len)):]
+	}
+	return attrs
+}
+
+func rtaAlign(n int) int {
+	return (n + syscall.RTA_ALIGNTO - 1) & ^(syscall.RTA_ALIGNTO - 1)
+}
+
+// BridgeVlan returns the vlan of the bridge name, which is prefix followed
+// by the vlan id.
+func BridgeVlan(prefix, name string) (int, bool) {
+	if prefix == "" || !strings.HasPrefix(name, prefix) {
+		return 0, false
+	}
+	vlan, err := strconv.Atoi(strings.TrimPrefix(name, prefix))
+	if err != nil || vlan < 1 || vlan > 4094 {
+		return 0, false
+	}
+	return vlan, true
+}
@@ -0,0 +1,124 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"ha-bridge/pkg/metrics"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	kubev1 "kubevirt.io/client-go/api/v1"
+	"sync"
+)
+
+// Component is the event source reported to the API server.
+const Component = "habridge"
+
+// Reasons of the events recorded by the agent.
+const (
+	ReasonBondFailover       = "BondFailover"
+	ReasonScopedAnnounce     = "ScopedAnnounce"
+	ReasonAnnounced          = "AddressesAnnounced"
+	ReasonAnnounceFailed     = "AnnounceFailed"
+	ReasonDryRun             = "DryRunRound"
+	ReasonAddressRefused     = "AddressRefused"
+	ReasonAddressConflict    = "AddressConflict"
+	ReasonGatewayUnreachable = "GatewayUnreachable"
+	ReasonTrafficNotResumed  = "TrafficNotResumed"
+	ReasonGatewayChanged     = "GatewayChanged"
+)
+
+// Recorder records events for this node and its VMIs. A token bucket shared
+// by all objects caps how many events reach the client-go recorder, whose
+// correlator then aggregates similar events and filters spam per object.
+type Recorder struct {
+	recorder record.EventRecorder
+	limiter  flowcontrol.RateLimiter
+	node     *k8sv1.ObjectReference
+}
+
+// NewRecorder wraps r, letting through qps events per second with bursts of
+// up to burst events.
+func NewRecorder(r record.EventRecorder, node string, qps float32, burst int) *Recorder {
+	return &Recorder{
+		recorder: r,
+		limiter:  flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+		// the kubelet records node events with the node name as uid
+		node: &k8sv1.ObjectReference{Kind: "Node", Name: node, UID: types.UID(node)},
+	}
+}
+
+// Node records an event on this node.
+func (r *Recorder) Node(eventtype, reason, messageFmt string, args ...interface{}) {
+	r.eventf(r.node, eventtype, reason, messageFmt, args...)
+}
+
+// VMI records an event on vmi.
+func (r *Recorder) VMI(vmi *kubev1.VirtualMachineInstance, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.eventf(&k8sv1.ObjectReference{
+		APIVersion:      kubev1.GroupVersion.String(),
+		Kind:            kubev1.VirtualMachineInstanceGroupVersionKind.Kind,
+		Namespace:       vmi.Namespace,
+		Name:            vmi.Name,
+		UID:             vmi.UID,
+		ResourceVersion: vmi.ResourceVersion,
+	}, eventtype, reason, messageFmt, args...)
+}
+
+func (r *Recorder) eventf(ref *k8sv1.ObjectReference, eventtype, reason, messageFmt string, args ...interface{}) {
+	if !r.limiter.TryAccept() {
+		metrics.EventsDroppedTotal.WithLabelValues(reason).Inc()
+		klog.V(4).Infof("drop %s event on %s %s: %s", reason, ref.Kind, ref.Name, fmt.Sprintf(messageFmt, args...))
+		return
+	}
+	r.recorder.Eventf(ref, eventtype, reason, messageFmt, args...)
+}
+
+var (
+	mu      sync.RWMutex
+	current *Recorder
+)
+
+// Start sends the events recorded through the package functions to the API
+// server until ctx is done. Before Start they are discarded.
+func Start(ctx context.Context, client typedcorev1.EventsGetter, node string, qps float32, burst int) {
+	broadcaster := record.NewBroadcaster()
+	sink := broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.Events("")})
+	logging := broadcaster.StartLogging(klog.V(4).Infof)
+	r := NewRecorder(broadcaster.NewRecorder(scheme.Scheme, k8sv1.EventSource{Component: Component, Host: node}), node, qps, burst)
+	mu.Lock()
+	current = r
+	mu.Unlock()
+	go func() {
+		<-ctx.Done()
+		mu.Lock()
+		current = nil
+		mu.Unlock()
+		sink.Stop()
+		logging.Stop()
+	}()
+}
+
+// Node records an event on this node.
+func Node(eventtype, reason, messageFmt string, args ...interface{}) {
+	if r := get(); r != nil {
+		r.Node(eventtype, reason, messageFmt, args...)
+	}
+}
+
+// VMI records an event on vmi.
+func VMI(vmi *kubev1.VirtualMachineInstance, eventtype, reason, messageFmt string, args ...interface{}) {
+	if r := get(); r != nil {
+		r.VMI(vmi, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func get() *Recorder {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
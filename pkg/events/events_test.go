@@ -0,0 +1,31 @@
+package events
+
+import (
+	"strings"
+	"testing"
+
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	kubev1 "kubevirt.io/client-go/api/v1"
+)
+
+func TestRecorderRateLimit(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	r := NewRecorder(fake, "node-a", 0.0001, 2)
+	vmi := &kubev1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name = "default", "vm1"
+
+	r.Node(k8sv1.EventTypeNormal, ReasonBondFailover, "bond %s", "bond0")
+	r.VMI(vmi, k8sv1.EventTypeNormal, ReasonAnnounced, "announced %s", "10.0.0.2")
+	r.VMI(vmi, k8sv1.EventTypeWarning, ReasonAnnounceFailed, "dropped")
+
+	if len(fake.Events) != 2 {
+		t.Fatalf("expected the burst of 2 events to pass, got %d", len(fake.Events))
+	}
+	if e := <-fake.Events; !strings.Contains(e, "BondFailover bond bond0") {
+		t.Errorf("unexpected node event %q", e)
+	}
+	if e := <-fake.Events; !strings.Contains(e, "AddressesAnnounced announced 10.0.0.2") {
+		t.Errorf("unexpected vmi event %q", e)
+	}
+}
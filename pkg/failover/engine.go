@@ -0,0 +1,156 @@
+package failover
+
+import (
+	"context"
+	"ha-bridge/pkg/metrics"
+	"k8s.io/klog/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// SourceNetlink is the trigger source of bond link events.
+	SourceNetlink = "netlink"
+	// SourceAnnounceRequest is the trigger source of scoped rounds run for
+	// an AnnounceRequest.
+	SourceAnnounceRequest = "announcerequest"
+	// SourceStartup is the trigger source of the catch-up round run when
+	// the agent finds at startup that a bond failed over while it was down.
+	SourceStartup = "startup"
+	// SourceGatewayCheck is the trigger source of the rounds announcing
+	// again the vlans whose gateway did not reply after a round.
+	SourceGatewayCheck = "gatewaycheck"
+	// SourceTrafficCheck is the trigger source of the rounds announcing
+	// again the VMIs that sent no unicast packets after a round.
+	SourceTrafficCheck = "trafficcheck"
+	// SourceGateway is the trigger source of the rounds announcing a vlan
+	// whose gateway moved to another router or mac.
+	SourceGateway = "gateway"
+)
+
+// Cause describes what triggered a failover round.
+type Cause struct {
+	Source string
+	At     time.Time
+	// Bond, OldSlave and NewSlave are set when the bond listener triggered
+	// the round; OldSlave equals NewSlave when the slave did not change.
+	Bond     string
+	OldSlave string
+	NewSlave string
+	// Request is the AnnounceRequest, as namespace/name, of a scoped round.
+	Request string
+	// Vlan is the vlan a round is scoped to, 0 for all of them.
+	Vlan int
+}
+
+// vlans returns the vlans a round for c announces on, nil for all of them.
+func (c Cause) vlans() map[int]bool {
+	if c.Vlan == 0 {
+		return nil
+	}
+	return map[int]bool{c.Vlan: true}
+}
+
+var (
+	// triggers holds at most one pending round; triggers arriving while one
+	// is already queued are folded into it.
+	triggers = make(chan Cause, 1)
+	// accepting is cleared once Run returns, after which Trigger is a no-op.
+	accepting int32 = 1
+
+	roundCtx, cancelRounds = context.WithCancel(context.Background())
+	runDone                = make(chan struct{})
+	runOnce                sync.Once
+	running                int32
+
+	summary struct {
+		rounds, sent, failed, dropped int64
+	}
+
+	roundHooks []func(*Report)
+)
+
+// OnRound registers f to receive the report of every round, scoped ones
+// included. It must be called before Run.
+func OnRound(f func(*Report)) {
+	roundHooks = append(roundHooks, f)
+}
+
+// Trigger requests a failover round on behalf of source. It never blocks the
+// caller, which is usually the netlink listener.
+func Trigger(source string) bool {
+	return trigger(Cause{Source: source})
+}
+
+// TriggerBond requests a failover round for bond, whose active slave moved
+// from oldSlave to newSlave.
+func TriggerBond(bond, oldSlave, newSlave string) bool {
+	return trigger(Cause{Source: SourceNetlink, Bond: bond, OldSlave: oldSlave, NewSlave: newSlave})
+}
+
+// TriggerStartup requests the catch-up round for bond, whose active slave
+// moved from oldSlave to newSlave while the agent was down. bond is empty
+// when the agent has no prior state to compare with.
+func TriggerStartup(bond, oldSlave, newSlave string) bool {
+	return trigger(Cause{Source: SourceStartup, Bond: bond, OldSlave: oldSlave, NewSlave: newSlave})
+}
+
+func trigger(c Cause) bool {
+	source := c.Source
+	if atomic.LoadInt32(&accepting) == 0 {
+		klog.Warningf("habridge is shutting down, ignore %s trigger", source)
+		return false
+	}
+	metrics.TriggersTotal.WithLabelValues(source).Inc()
+	c.At = time.Now()
+	select {
+	case triggers <- c:
+		klog.Infof("failover triggered by %s", source)
+	default:
+		atomic.AddInt64(&summary.dropped, 1)
+		klog.Infof("failover round already pending, fold %s trigger into it", source)
+	}
+	return true
+}
+
+// Run serves failover rounds until ctx is done. A round in progress when ctx
+// is cancelled runs on; Shutdown bounds how long it may take.
+func Run(ctx context.Context) {
+	runOnce.Do(func() {
+		atomic.StoreInt32(&running, 1)
+		defer close(runDone)
+		defer atomic.StoreInt32(&accepting, 0)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case c := <-triggers:
+				if ctx.Err() != nil {
+					return
+				}
+				OnBondFailOver(roundCtx, c)
+			}
+		}
+	})
+}
+
+// Shutdown waits up to timeout for Run to finish the current round, cancels
+// the round if it is still running after that, and logs a final summary.
+func Shutdown(timeout time.Duration) {
+	atomic.StoreInt32(&accepting, 0)
+	if atomic.LoadInt32(&running) == 0 {
+		runOnce.Do(func() { close(runDone) })
+	}
+	select {
+	case <-runDone:
+	case <-time.After(timeout):
+		klog.Warningf("failover round still running after %v, cancel it", timeout)
+		cancelRounds()
+		<-runDone
+	}
+	cancelRounds()
+	klog.Infof("habridge stopped: %d failover rounds, %d frames sent, %d failed, %d triggers folded",
+		atomic.LoadInt64(&summary.rounds), atomic.LoadInt64(&summary.sent),
+		atomic.LoadInt64(&summary.failed), atomic.LoadInt64(&summary.dropped))
+}
@@ -1,133 +1,703 @@
 package failover
 
 import (
-	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/google/gopacket/pcap"
-	"ha-bridge/pkg/garp"
+	"ha-bridge/pkg/announce"
+	"ha-bridge/pkg/checkpoint"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/conflict"
+	"ha-bridge/pkg/discovery"
+	"ha-bridge/pkg/events"
+	"ha-bridge/pkg/health"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/metrics"
+	"ha-bridge/pkg/plan"
+	"ha-bridge/pkg/policy"
+	"ha-bridge/pkg/reachability"
+	"ha-bridge/pkg/traffic"
+	k8sv1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	v1 "kubevirt.io/client-go/api/v1"
 	"net"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// VirtInformer watches the VMIs labelled with this node, MigrationInformer
+// the VMIs being migrated onto it.
 var VirtInformer cache.SharedIndexInformer
-var IpamInformer cache.SharedIndexInformer
+var MigrationInformer cache.SharedIndexInformer
 
-const indexName = "node"
+var HOST_NAME string
 
-const broadcastMacStr = "ff:ff:ff:ff:ff:ff"
+var roundHealth = health.Register("failover", nil, 0)
 
-var HOST_NAME string
+// syncPollInterval is how often a round waiting for the informers checks
+// them.
+const syncPollInterval = 100 * time.Millisecond
+
+func init() {
+	announce.OpenLink = func(name string) (announce.Link, error) {
+		return pcap.OpenLive(name, config.Get().SnapLen, true, 3*time.Millisecond)
+	}
+}
+
+// OnBondFailOver runs one announcement round for every VMI on this node, for
+// the trigger described by cause. Cancelling ctx stops the senders that have
+// not written their frames yet.
+func OnBondFailOver(ctx context.Context, cause Cause) *Report {
+	return runRound(ctx, cause, nil)
+}
+
+// Announce runs a round scoped to the VMIs on this node that match, all of
+// them when match is nil, and to cause.Vlan when set, as asked by an
+// AnnounceRequest or a gateway change. It waits for the round in progress,
+// if any.
+func Announce(ctx context.Context, cause Cause, match func(*v1.VirtualMachineInstance) bool) *Report {
+	metrics.TriggersTotal.WithLabelValues(cause.Source).Inc()
+	if cause.At.IsZero() {
+		cause.At = time.Now()
+	}
+	return runRound(ctx, cause, match)
+}
+
+// roundMutex keeps rounds from overlapping, so two rounds never race their
+// frames for the same address.
+var roundMutex sync.Mutex
+
+// runRound runs the round of cause and, when its gateway check fails for
+// some vlans, up to GatewayRetries more rounds announcing only those. When
+// cfg checks the traffic, it then follows the VMIs of the round and announces
+// again those receiving no packets, letting other rounds run meanwhile. The
+// reports of all these rounds are only published once it is done, and it
+// returns the report of the first.
+func runRound(ctx context.Context, cause Cause, match func(*v1.VirtualMachineInstance) bool) *Report {
+	cfg := config.Get()
+	roundMutex.Lock()
+	report := round(ctx, cause, match, cause.vlans())
+	reports := []*Report{report}
+	last := report
+	for retry := 0; retry < cfg.GatewayRetries; retry++ {
+		vlans := last.unreachable()
+		if len(vlans) == 0 || ctx.Err() != nil {
+			break
+		}
+		var list []string
+		for vlan := range vlans {
+			list = append(list, strconv.Itoa(vlan))
+		}
+		sort.Strings(list)
+		klog.Warningf("gateways of vlans %s did not reply, announce them again", strings.Join(list, ", "))
+		again := cause
+		again.Source, again.At = SourceGatewayCheck, time.Now()
+		metrics.TriggersTotal.WithLabelValues(again.Source).Inc()
+		last = round(ctx, again, match, vlans)
+		reports = append(reports, last)
+	}
+	roundMutex.Unlock()
+	if cfg.TrafficCheck && !cfg.DryRun {
+		var retries []*Report
+		report.Unrecovered, retries = followTraffic(ctx, cfg, report)
+		reports = append(reports, retries...)
+	}
+	for _, r := range reports {
+		r.recordEvents()
+		for _, f := range roundHooks {
+			f(r)
+		}
+	}
+	return report
+}
 
-func OnBondFailOver() {
-	klog.Infoln("bond fail over.....")
-	vmList := getAllLocalVMList()
+// round runs one round for cause, announcing only on vlans unless nil.
+func round(ctx context.Context, cause Cause, match func(*v1.VirtualMachineInstance) bool, vlans map[int]bool) *Report {
+	klog.Infof("bond fail over, triggered by %s.....", cause.Source)
+	start := time.Now()
+	cfg := config.Get()
+	report := &Report{Cause: cause, DryRun: cfg.DryRun, Plan: &plan.Plan{}}
+	var vmList []v1.VirtualMachineInstance
+	var lookup plan.BridgeLookup
+	build := func(vmi *v1.VirtualMachineInstance) *plan.Plan {
+		return announce.Build(cfg, vmi, lookup)
+	}
+	if cp, discovered := fallback(ctx, cfg); cp != nil {
+		report.FromCheckpoint, report.FromDiscovery, report.CheckpointTime = !discovered, discovered, cp.Time
+		targets := map[string][]plan.Target{}
+		for i := range cp.VMIs {
+			vmList = append(vmList, *cp.VMIs[i].Object())
+			targets[cp.VMIs[i].Namespace+"/"+cp.VMIs[i].Name] = cp.VMIs[i].Targets
+		}
+		build = func(vmi *v1.VirtualMachineInstance) *plan.Plan {
+			targets := targets[vmi.Namespace+"/"+vmi.Name]
+			var skipped []plan.Skip
+			if discovered && cfg.VerifyOwnership {
+				targets, skipped = withinPools(cp, targets)
+			}
+			p := announce.BuildTargets(cfg, targets)
+			p.Skipped = append(skipped, p.Skipped...)
+			return p
+		}
+	} else {
+		vmList, report.Plan.Skipped = plan.Select(listVMIs(), HOST_NAME)
+		lookup = bridgeLookup(cfg)
+	}
+	if match != nil {
+		var matched []v1.VirtualMachineInstance
+		for i := range vmList {
+			if match(&vmList[i]) {
+				matched = append(matched, vmList[i])
+			}
+		}
+		vmList = matched
+		// a scoped round only accounts for the VMIs it was asked for
+		report.Plan.Skipped = nil
+	}
+	if vlans != nil {
+		build = onVlans(build, vlans)
+		report.Plan.Skipped = nil
+	}
 	if vmList == nil || len(vmList) == 0 {
 		klog.Infof("can not find vmi on node %s", HOST_NAME)
 
 	}
-	handleVMI(vmList)
-
+	report.VMIs = handleVMI(ctx, cfg, vmList, build, report.Plan)
+	// the duration is that of the announcements, which the gateway check
+	// only waits on
+	metrics.RoundDuration.Observe(time.Since(cause.At).Seconds())
+	if cfg.GatewayCheck && !cfg.DryRun {
+		report.Gateways = verifyGateways(ctx, cfg, report.Plan)
+	}
+	for _, vmi := range report.VMIs {
+		report.Sent += vmi.Sent
+		report.Failed += vmi.Failed
+		for _, a := range vmi.Announcers {
+			total := announcerReport(&report.Announcers, a.Name)
+			total.Sent += a.Sent
+			total.Failed += a.Failed
+		}
+	}
+	report.Duration = time.Since(start)
+	if report.Failed > 0 {
+		roundHealth.Error(fmt.Errorf("round triggered by %s: %d of %d frames failed", cause.Source, report.Failed, report.Sent+report.Failed))
+	}
+	atomic.AddInt64(&summary.rounds, 1)
+	atomic.AddInt64(&summary.sent, int64(report.Sent))
+	atomic.AddInt64(&summary.failed, int64(report.Failed))
+	if report.DryRun {
+		logPlan(report.Plan)
+	}
+	klog.Infof("failover round finished in %v: %d vmi, %d frames sent, %d failed", report.Duration, len(vmList), report.Sent, report.Failed)
+	return report
 }
 
-//todo benchmark
-func sendGarp(macstr, ipstr, linkBridgeOnHost string) {
-	klog.Infof("send gratuitous arp from ip:%s ,mac:%s  on  interface: %s ", ipstr, macstr, linkBridgeOnHost)
-	handle, err := pcap.OpenLive(linkBridgeOnHost, 65536, true, 3*time.Millisecond)
-	if err != nil {
-		klog.Fatal(err)
+// fallback returns the checkpoint a round announces from instead of the
+// informers, which it gives SyncWaitTimeout to sync: the saved checkpoint if
+// any, else what discovery finds on the bridges when enabled, in which case
+// it also returns true. It returns nil when the informers have synced or when
+// nothing can stand in for them, and the round goes with whatever they hold.
+func fallback(ctx context.Context, cfg *config.Config) (*checkpoint.Checkpoint, bool) {
+	if waitForSync(ctx, cfg.SyncWaitTimeout.Duration) {
+		return nil, false
 	}
-	defer handle.Close()
-	src := net.ParseIP(ipstr)
-	mac, err := net.ParseMAC(macstr)
-	if err != nil {
-		klog.Error(err)
+	if cp := loadCheckpoint(cfg); cp != nil {
+		klog.Warningf("informers not synced, announce from the checkpoint of %s", cp.Time.Format(time.RFC3339))
+		return cp, false
+	}
+	if !cfg.Discovery {
+		return nil, false
 	}
-	broadcastMac, err := net.ParseMAC(broadcastMacStr)
+	cp, err := discovery.Checkpoint(cfg, HOST_NAME)
 	if err != nil {
-		klog.Error(err)
+		klog.Errorf("informers not synced, discover vmis: %v", err)
+		return nil, false
 	}
-	garp.SendAFakeArpRequest(handle, src, src, broadcastMac, mac)
+	klog.Warningf("informers not synced, announce the %d ports discovered on the bridges", len(cp.VMIs))
+	return cp, true
 }
 
-func getAllLocalVMList() []v1.VirtualMachineInstance {
-	var result []v1.VirtualMachineInstance
-	obj, err := VirtInformer.GetIndexer().ByIndex(indexName, HOST_NAME)
+// withinPools leaves out of targets the addresses outside the pool cidrs cp
+// recorded for their vlan. Discovery learns the addresses from what the
+// guests claim, which no IPRecorder vouches for.
+func withinPools(cp *checkpoint.Checkpoint, targets []plan.Target) ([]plan.Target, []plan.Skip) {
+	var skipped []plan.Skip
+	result := make([]plan.Target, 0, len(targets))
+	for _, t := range targets {
+		var ips []string
+		for _, ip := range t.IPs {
+			if cp.InPools(t.Vlan, ip) {
+				ips = append(ips, ip)
+				continue
+			}
+			skipped = append(skipped, plan.Skip{Namespace: t.Namespace, VMI: t.VMI, Interface: t.Interface, IP: ip,
+				Reason: plan.ReasonAddressOutsidePool, Message: fmt.Sprintf("refuse to announce discovered ip %s outside the ippools of vlan %d", ip, t.Vlan)})
+		}
+		t.IPs = ips
+		result = append(result, t)
+	}
+	return result, skipped
+}
 
-	if err != nil {
-		klog.Fatal(err)
+// loadCheckpoint returns the checkpoint of this node, nil when there is none
+// or when it is older than CheckpointMaxAge.
+func loadCheckpoint(cfg *config.Config) *checkpoint.Checkpoint {
+	path := checkpoint.Path()
+	if path == "" {
+		klog.Warning("informers not synced and no checkpoint is kept")
+		return nil
+	}
+	cp, err := checkpoint.Load(path)
+	switch {
+	case err != nil:
+		klog.Errorf("informers not synced, load checkpoint: %v", err)
+		return nil
+	case cp == nil:
+		klog.Warningf("informers not synced and no checkpoint in %s yet", path)
+		return nil
+	case cp.Node != HOST_NAME:
+		klog.Warningf("informers not synced, ignore the checkpoint of node %s", cp.Node)
+		return nil
+	case cfg.CheckpointMaxAge.Duration > 0 && time.Since(cp.Time) > cfg.CheckpointMaxAge.Duration:
+		klog.Warningf("informers not synced, ignore the checkpoint of %s, older than %v", cp.Time.Format(time.RFC3339), cfg.CheckpointMaxAge.Duration)
+		return nil
 	}
-	for i := 0; i < len(obj); i++ {
-		if vmi, ok := obj[i].(*v1.VirtualMachineInstance); ok {
-			result = append(result, *vmi)
+	return cp
+}
+
+// synced reports whether all the informers a round reads have synced.
+func synced() bool {
+	informers := []cache.SharedIndexInformer{VirtInformer, MigrationInformer, ipam.RecorderInformer, ipam.PoolInformer,
+		ipam.PodInformer, policy.PolicyInformer, policy.NamespaceInformer}
+	for _, informer := range informers {
+		if informer == nil || !informer.HasSynced() {
+			return false
 		}
 	}
-	return result
+	return true
 }
 
-func getipvlan(ip string) (string, error) {
-	obj, err := IpamInformer.GetIndexer().ByIndex("ipaddress", ip)
-	if err != nil {
-		klog.Fatal(err)
+// waitForSync waits up to timeout for the informers to sync.
+func waitForSync(ctx context.Context, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !synced() {
+		if time.Now().After(deadline) || ctx.Err() != nil {
+			return false
+		}
+		time.Sleep(syncPollInterval)
 	}
-	if len(obj) == 1 {
-		result := strconv.Itoa(obj[0].(*v2.IPRecorder).IPLists[0].Vlan)
-		return result, nil
-	} else {
-		return ip, fmt.Errorf("coun't find ip is %s", ip)
+	return true
+}
+
+// Checkpoint returns the mapping of the local VMIs to the bridges a round
+// announces them on, with the pool cidrs and opt-outs discovery goes by, or
+// false while the informers have not synced.
+func Checkpoint() (*checkpoint.Checkpoint, bool) {
+	if !synced() {
+		return nil, false
 	}
+	cfg := config.Get()
+	vmis, _ := plan.Select(listVMIs(), HOST_NAME)
+	lookup := bridgeLookup(cfg)
+	c := &checkpoint.Checkpoint{Node: HOST_NAME, Time: time.Now(), VMIs: []checkpoint.VMI{}, Cidrs: ipam.VlanCidrs()}
+	for i := range vmis {
+		vmi := &vmis[i]
+		if annotations, _ := plan.ParseAnnotations(vmi); annotations.Disabled {
+			for _, intf := range vmi.Status.Interfaces {
+				if mac, err := net.ParseMAC(intf.MAC); err == nil {
+					c.OptedOut = append(c.OptedOut, mac.String())
+				}
+			}
+		}
+		targets, _ := plan.Resolve(cfg, vmi, lookup)
+		c.VMIs = append(c.VMIs, checkpoint.VMI{Namespace: vmi.Namespace, Name: vmi.Name, UID: vmi.UID, Labels: vmi.Labels, Targets: targets})
+	}
+	return c, true
 }
 
-//TODO get vlan with ip from ipam cr
-func getBridgeOnHOst(ip string) string {
-	vlanid, err := getipvlan(ip)
+// lookupBridges reads the bridge fdb; tests replace it.
+var lookupBridges = discovery.Lookup
+
+// bridgeLookup returns where the bridges have learned the macs, which places
+// the interfaces announced by their mac alone, nil when the fdb cannot be
+// read.
+func bridgeLookup(cfg *config.Config) plan.BridgeLookup {
+	lookup, err := lookupBridges(cfg)
 	if err != nil {
-		klog.Fatal(err)
+		klog.Errorf("read bridge fdb, interfaces without ip addresses are not announced: %v", err)
+		return nil
+	}
+	return lookup
+}
+
+// logPlan logs the plan of a dry-run round as JSON.
+func logPlan(p *plan.Plan) {
+	data, err := json.Marshal(p)
+	if err != nil {
+		klog.Errorf("marshal dry-run plan: %v", err)
+		return
+	}
+	klog.Infof("dry-run round planned %d frames and skipped %d: %s", len(p.Frames), len(p.Skipped), data)
+}
+
+// LocalVMICount returns the number of VMIs currently running on this node.
+func LocalVMICount() int {
+	vmis, _ := plan.Select(listVMIs(), HOST_NAME)
+	return len(vmis)
+}
+
+// listVMIs returns the VMIs labelled with this node or being migrated onto
+// it, which plan.Select narrows down to those running here.
+func listVMIs() []v1.VirtualMachineInstance {
+	var result []v1.VirtualMachineInstance
+	for _, informer := range []cache.SharedIndexInformer{VirtInformer, MigrationInformer} {
+		if informer == nil {
+			continue
+		}
+		obj := informer.GetStore().List()
+		for i := 0; i < len(obj); i++ {
+			if vmi, ok := obj[i].(*v1.VirtualMachineInstance); ok {
+				result = append(result, *vmi)
+			}
+		}
 	}
-	result := fmt.Sprint("vlan", vlanid)
 	return result
 }
 
-func handleVMI(vmList []v1.VirtualMachineInstance) {
-	for _, vm := range vmList {
-		klog.Infoln("get vm  ", vm.Name)
-		for _, intf := range vm.Status.Interfaces {
-			if intf.InterfaceName == "eth0" {
-				//if strings.Contains(intf.InterfaceName, "eth") {
-				klog.Infoln("get vm has eth0  ", vm.Name)
-				mac := intf.MAC
-				hasVlanip := intf.IP
-				ip := intf.IPs
-				linkBridgeOnHost := getBridgeOnHOst(hasVlanip)
-				for _, vmip := range ip {
-					Ipfamily := ipfamily(vmip)
-					switch Ipfamily {
-					case 4:
-						go sendGarp(mac, vmip, linkBridgeOnHost)
+// handleVMI plans the frames of vmList with build into roundPlan and, unless
+// cfg asks for a dry run, sends them: the frames of each interface in the
+// order of its announcers, the interfaces side by side, those of higher
+// priority before the others. When cfg checks for conflicts, the addresses
+// another mac answers for are left out first.
+func handleVMI(ctx context.Context, cfg *config.Config, vmList []v1.VirtualMachineInstance, build func(*v1.VirtualMachineInstance) *plan.Plan, roundPlan *plan.Plan) []*VMIReport {
+	var plans []*plan.Plan
+	for i := range vmList {
+		klog.Infoln("get vm  ", vmList[i].Name)
+		plans = append(plans, build(&vmList[i]))
+	}
+	if cfg.ConflictCheck && !cfg.DryRun {
+		checkConflicts(ctx, cfg, plans)
+	}
+	var reports []*VMIReport
+	// tiers holds the frames of every interface by priority
+	tiers := map[int][]interfaceFrames{}
+	for i := range vmList {
+		vm, vmPlan := &vmList[i], plans[i]
+		report := newVMIReport(vm)
+		reports = append(reports, report)
+		roundPlan.Add(vmPlan)
+		var refused, conflicts []string
+		for _, skip := range vmPlan.Skipped {
+			switch {
+			case skip.Refused():
+				metrics.AddressesRefusedTotal.WithLabelValues(skip.Reason).Inc()
+				refused = append(refused, skip.Message)
+			case skip.Reason == plan.ReasonAddressConflict:
+				conflicts = append(conflicts, skip.Message)
+			}
+			if !skip.Expected() {
+				klog.Errorf("skip vm %s/%s: %s", vm.Namespace, vm.Name, skip.Message)
+				report.Errors = append(report.Errors, skip.Message)
+			}
+		}
+		if len(refused) > 0 {
+			events.VMI(vm, k8sv1.EventTypeWarning, events.ReasonAddressRefused, "%s", strings.Join(refused, "; "))
+		}
+		if len(conflicts) > 0 {
+			events.VMI(vm, k8sv1.EventTypeWarning, events.ReasonAddressConflict, "%s", strings.Join(conflicts, "; "))
+		}
+		var order []string
+		interfaces := map[string][]plan.Frame{}
+		for _, frame := range vmPlan.Frames {
+			if frame.Bridge != "" {
+				report.addBridge(frame.Bridge)
+			}
+			if frame.IP != "" {
+				report.addIP(frame.IP)
+			}
+			if _, ok := interfaces[frame.Interface]; !ok {
+				order = append(order, frame.Interface)
+			}
+			interfaces[frame.Interface] = append(interfaces[frame.Interface], frame)
+		}
+		for _, intf := range order {
+			frames := interfaces[intf]
+			tiers[frames[0].Priority] = append(tiers[frames[0].Priority], interfaceFrames{report: report, frames: frames})
+		}
+	}
+	if cfg.DryRun {
+		return reports
+	}
+	var priorities []int
+	for priority := range tiers {
+		priorities = append(priorities, priority)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+	// mu guards the reports while the senders fill them in
+	var mu sync.Mutex
+	for _, priority := range priorities {
+		var wg sync.WaitGroup
+		for _, group := range tiers[priority] {
+			wg.Add(1)
+			go func(report *VMIReport, frames []plan.Frame) {
+				defer wg.Done()
+				for _, frame := range frames {
+					written, err := announce.Send(ctx, cfg, frame)
+					vlan := strconv.Itoa(frame.Vlan)
+					if frame.Data != nil {
+						metrics.FramesSentTotal.WithLabelValues(frame.Bridge, vlan, announce.Family(frame)).Add(float64(written))
+					}
+					result := "succeeded"
+					if err != nil {
+						result = "failed"
+						if frame.Data != nil {
+							metrics.FramesFailedTotal.WithLabelValues(frame.Bridge, vlan, announce.Family(frame)).Inc()
+						}
 					}
+					metrics.AnnouncementsTotal.WithLabelValues(frame.Kind, result).Inc()
+					mu.Lock()
+					report.addResult(frame.Kind, err)
+					if err != nil {
+						klog.Errorf("%s for vm %s/%s on %s: %v", frame.Kind, frame.Namespace, frame.VMI, frame.Bridge, err)
+						report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", frame.Kind, err))
+					}
+					mu.Unlock()
 				}
-				//linkBridgeOnHost := getBridgeOnHOst(hasVlanip)
-				//go sendGarp(mac, hasVlanip, linkBridgeOnHost)
+			}(group.report, group.frames)
+		}
+		wg.Wait()
+	}
+	return reports
+}
+
+// onVlans narrows the plans of build down to the frames announcing on
+// vlans, for a round announcing them again.
+func onVlans(build func(*v1.VirtualMachineInstance) *plan.Plan, vlans map[int]bool) func(*v1.VirtualMachineInstance) *plan.Plan {
+	return func(vmi *v1.VirtualMachineInstance) *plan.Plan {
+		p := &plan.Plan{}
+		for _, frame := range build(vmi).Frames {
+			if frame.Interface != "" && vlans[frame.Vlan] {
+				p.Frames = append(p.Frames, frame)
 			}
 		}
+		return p
 	}
 }
 
-func ipfamily(s string) int {
-	ip := net.ParseIP(s)
-	if ip == nil {
-		return 0
+// readCounters and lookupPorts read the packet counters of the links and
+// the bridge port of each mac; tests replace them.
+var (
+	readCounters = traffic.ReadCounters
+	lookupPorts  = discovery.Ports
+)
+
+// followTraffic follows the unicast packets the bridge ports of the VMIs
+// announced by report receive from them, and announces again those sending
+// none within cfg.TrafficWindow, doubling the window each time, up to
+// TrafficRetries times. It only holds roundMutex for the rounds it runs, not
+// while it waits. It stops early when ctx is done or another round is
+// pending, which announces them anyway. It returns the VMIs still quiet, as
+// namespace/name, and the reports of the rounds it ran.
+func followTraffic(ctx context.Context, cfg *config.Config, report *Report) ([]string, []*Report) {
+	macs, err := lookupPorts(cfg)
+	if err != nil {
+		klog.Errorf("traffic check, read bridge fdb: %v", err)
+		return nil, nil
+	}
+	before, err := readCounters()
+	if err != nil {
+		klog.Errorf("traffic check: %v", err)
+		return nil, nil
+	}
+	// ports holds the bridge ports of each VMI that can be followed
+	ports := map[string][]string{}
+	seen := map[string]bool{}
+	for _, frame := range report.Plan.Frames {
+		hw, err := net.ParseMAC(frame.MAC)
+		if err != nil || frame.Interface == "" {
+			continue
+		}
+		key, port := frame.Namespace+"/"+frame.VMI, macs[hw.String()]
+		if _, ok := before[port]; !ok || seen[key+"/"+port] {
+			continue
+		}
+		seen[key+"/"+port] = true
+		ports[key] = append(ports[key], port)
 	}
-	for i := 0; i < len(s); i++ {
-		switch s[i] {
-		case '.':
-			return 4
-		case ':':
-			return 6
+	var pending []string
+	for _, vmi := range report.Announced() {
+		if len(ports[vmi]) > 0 {
+			pending = append(pending, vmi)
+		}
+	}
+	var reports []*Report
+	window := cfg.TrafficWindow.Duration
+	for retry := 0; len(pending) > 0; retry++ {
+		if !pause(ctx, window) {
+			klog.Infof("stop following the traffic of %d vmis", len(pending))
+			return pending, reports
+		}
+		after, err := readCounters()
+		if err != nil {
+			klog.Errorf("traffic check: %v", err)
+			return pending, reports
 		}
+		var quiet []string
+		for _, vmi := range pending {
+			if !traffic.Grew(ports[vmi], before, after) {
+				quiet = append(quiet, vmi)
+			}
+		}
+		pending, before = quiet, after
+		if len(pending) == 0 || retry == cfg.TrafficRetries {
+			break
+		}
+		klog.Warningf("no packets from %s within %v, announce them again", strings.Join(pending, ", "), window)
+		metrics.VMIsReannouncedTotal.Add(float64(len(pending)))
+		metrics.TriggersTotal.WithLabelValues(SourceTrafficCheck).Inc()
+		again := report.Cause
+		again.Source, again.At = SourceTrafficCheck, time.Now()
+		roundMutex.Lock()
+		reports = append(reports, round(ctx, again, matchNames(pending), again.vlans()))
+		roundMutex.Unlock()
+		window *= 2
+	}
+	if len(pending) > 0 {
+		klog.Errorf("vmis %s never sent packets after the round", strings.Join(pending, ", "))
+		metrics.VMIsUnrecoveredTotal.Add(float64(len(pending)))
 	}
-	return 0
+	return pending, reports
+}
+
+// pause waits for d and tells whether the round may go on: it may not once
+// ctx is done or another round is pending.
+func pause(ctx context.Context, d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for time.Now().Before(deadline) {
+		if ctx.Err() != nil || len(triggers) > 0 {
+			return false
+		}
+		wait := time.Until(deadline)
+		if wait > syncPollInterval {
+			wait = syncPollInterval
+		}
+		time.Sleep(wait)
+	}
+	return ctx.Err() == nil
+}
+
+// matchNames matches the VMIs of names, as namespace/name.
+func matchNames(names []string) func(*v1.VirtualMachineInstance) bool {
+	set := map[string]bool{}
+	for _, name := range names {
+		set[name] = true
+	}
+	return func(vmi *v1.VirtualMachineInstance) bool {
+		return set[vmi.Namespace+"/"+vmi.Name]
+	}
+}
+
+// checkGateways asks gateways for their mac; tests replace it.
+var checkGateways = reachability.Check
+
+// verifyGateways checks the gateway of every bridge the frames of p
+// announced an ipv4 address on, asked for on behalf of the first of them.
+func verifyGateways(ctx context.Context, cfg *config.Config, p *plan.Plan) []reachability.Result {
+	var gateways []reachability.Gateway
+	seen := map[string]bool{}
+	for _, frame := range p.Frames {
+		key := frame.Bridge + "/" + frame.Gateway
+		if frame.Data == nil || frame.Gateway == "" || frame.Bridge == "" || announce.Family(frame) != "ipv4" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		gateways = append(gateways, reachability.Gateway{Vlan: frame.Vlan, Bridge: frame.Bridge, Gateway: frame.Gateway, IP: frame.IP, MAC: frame.MAC})
+	}
+	if len(gateways) == 0 {
+		return nil
+	}
+	results := checkGateways(ctx, cfg, gateways)
+	for _, r := range results {
+		result := "reachable"
+		switch {
+		case r.Error != "":
+			result = "error"
+		case !r.Reachable:
+			result = "unreachable"
+		}
+		metrics.GatewayChecksTotal.WithLabelValues(strconv.Itoa(r.Vlan), result).Inc()
+		if r.Reachable {
+			klog.Info(r.String())
+		} else {
+			klog.Warning(r.String())
+		}
+	}
+	return results
+}
+
+// checkAddresses probes addresses for conflicts; tests replace it.
+var checkAddresses = conflict.Check
+
+// checkConflicts probes the ipv4 addresses the frames of plans announce and
+// turns the frames of those another mac answers for into skips.
+func checkConflicts(ctx context.Context, cfg *config.Config, plans []*plan.Plan) {
+	var probes []conflict.Probe
+	seen := map[conflict.Probe]bool{}
+	for _, p := range plans {
+		for _, frame := range p.Frames {
+			probe := conflict.Probe{Bridge: frame.Bridge, IP: frame.IP, MAC: frame.MAC}
+			if frame.Data == nil || frame.IP == "" || frame.Bridge == "" || seen[probe] {
+				continue
+			}
+			seen[probe] = true
+			probes = append(probes, probe)
+		}
+	}
+	if len(probes) == 0 {
+		return
+	}
+	start := time.Now()
+	found, err := checkAddresses(ctx, cfg, probes)
+	if err != nil {
+		klog.Errorf("conflict check: %v", err)
+	}
+	klog.Infof("probed %d addresses in %v, %d in use by another mac", len(probes), time.Since(start), len(found))
+	conflicts := map[string]conflict.Conflict{}
+	for _, c := range found {
+		conflicts[c.Bridge+"/"+c.IP] = c
+		metrics.AddressConflictsTotal.WithLabelValues(c.Bridge).Inc()
+	}
+	if len(conflicts) == 0 {
+		return
+	}
+	for _, p := range plans {
+		var frames []plan.Frame
+		skipped := map[string]bool{}
+		for _, frame := range p.Frames {
+			key := frame.Bridge + "/" + frame.IP
+			c, ok := conflicts[key]
+			if !ok {
+				frames = append(frames, frame)
+				continue
+			}
+			if !skipped[frame.Interface+"/"+key] {
+				skipped[frame.Interface+"/"+key] = true
+				p.Skipped = append(p.Skipped, plan.Skip{Namespace: frame.Namespace, VMI: frame.VMI, Interface: frame.Interface,
+					IP: frame.IP, Reason: plan.ReasonAddressConflict, Message: c.String()})
+			}
+		}
+		p.Frames = frames
+	}
+}
+
+// interfaceFrames are the frames of one interface and the report of its VMI.
+type interfaceFrames struct {
+	report *VMIReport
+	frames []plan.Frame
 }
@@ -0,0 +1,474 @@
+package failover
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	"ha-bridge/pkg/announce"
+	"ha-bridge/pkg/checkpoint"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/conflict"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/plan"
+	"ha-bridge/pkg/reachability"
+	"ha-bridge/pkg/traffic"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	v1 "kubevirt.io/client-go/api/v1"
+)
+
+func TestTriggerFoldsPendingRounds(t *testing.T) {
+	for len(triggers) > 0 {
+		<-triggers
+	}
+	if !Trigger(SourceNetlink) || !Trigger(SourceNetlink) {
+		t.Fatal("trigger refused while accepting")
+	}
+	if len(triggers) != 1 {
+		t.Fatalf("expected one pending round, got %d", len(triggers))
+	}
+	<-triggers
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	recorders := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	recorders.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: "r"}, IPLists: []v2.IPRecorderIPLists{{IPAddress: "10.0.0.2", Vlan: 100}}})
+	ipam.RecorderInformer = recorders
+	vmis := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v1.VirtualMachineInstance{}, 0, cache.Indexers{})
+	vmi := &v1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vm1", UID: "vm1"}}
+	vmi.Status.NodeName = "node-a"
+	vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:01", IP: "10.0.0.2", IPs: []string{"10.0.0.2"}},
+	}
+	vmis.GetIndexer().Add(vmi)
+	VirtInformer, HOST_NAME = vmis, "node-a"
+	defer func() { VirtInformer = nil }()
+	cfg := config.Default()
+	cfg.DryRun = true
+	cfg.StateDir, cfg.SyncWaitTimeout.Duration, cfg.RARPBurst = "", 0, 0
+	cfg.VerifyOwnership = false
+	config.Set(cfg)
+	defer config.Set(config.Default())
+
+	report := OnBondFailOver(context.Background(), Cause{Source: SourceNetlink, At: time.Now()})
+	if report.Result() != "DryRun" || report.Sent != 0 || report.Failed != 0 {
+		t.Errorf("a dry run should write nothing: %+v", report)
+	}
+	if len(report.Plan.Frames) != 1 || report.Plan.Frames[0].Bridge != "vlan100" || len(report.VMIs[0].IPs) != 1 {
+		t.Errorf("unexpected plan %+v", report.Plan)
+	}
+}
+
+func TestFallBackToCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "habridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cfg := config.Default()
+	cfg.DryRun = true
+	cfg.StateDir, cfg.SyncWaitTimeout.Duration, cfg.RARPBurst = dir, 0, 0
+	config.Set(cfg)
+	defer config.Set(config.Default())
+	HOST_NAME, VirtInformer = "node-a", nil
+	saved := time.Now().Add(-time.Minute).Truncate(time.Second)
+	err = checkpoint.Save(checkpoint.Path(), &checkpoint.Checkpoint{Node: "node-a", Time: saved, VMIs: []checkpoint.VMI{
+		{Namespace: "default", Name: "vm1", Targets: []plan.Target{
+			{Namespace: "default", VMI: "vm1", Interface: "eth0", MAC: "02:00:00:00:00:01", IPs: []string{"10.0.0.2"}, Vlan: 100, Bridge: "vlan100"},
+		}},
+		{Namespace: "other", Name: "vm2", Targets: []plan.Target{
+			{Namespace: "other", VMI: "vm2", Interface: "eth0", MAC: "02:00:00:00:00:02", IPs: []string{"10.0.0.3"}, Vlan: 100, Bridge: "vlan100"},
+		}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Announce(context.Background(), Cause{Source: SourceAnnounceRequest}, func(vmi *v1.VirtualMachineInstance) bool {
+		return vmi.Namespace == "default"
+	})
+	if !report.FromCheckpoint || !report.CheckpointTime.Equal(saved) {
+		t.Errorf("the round should be marked as from the checkpoint: %+v", report)
+	}
+	if len(report.VMIs) != 1 || len(report.Plan.Frames) != 1 || report.Plan.Frames[0].IP != "10.0.0.2" {
+		t.Errorf("unexpected plan %+v", report.Plan)
+	}
+
+	cfg.CheckpointMaxAge.Duration = time.Second
+	if report := Announce(context.Background(), Cause{Source: SourceAnnounceRequest}, nil); report.FromCheckpoint || len(report.VMIs) != 0 {
+		t.Errorf("a stale checkpoint should not be announced from: %+v", report)
+	}
+}
+
+// fakeLink records the frames written on it.
+type fakeLink struct {
+	written *[][]byte
+	mu      *sync.Mutex
+}
+
+func (l fakeLink) WritePacketData(data []byte) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.written = append(*l.written, data)
+	return nil
+}
+
+func (l fakeLink) Close() {}
+
+// testVMI is a VMI of node-a whose eth0 at ip is recorded on vlan.
+type testVMI struct {
+	name, mac, ip, gateway string
+	vlan                   int
+}
+
+// testLinks records the links the rounds open and the frames written on them.
+type testLinks struct {
+	mu      sync.Mutex
+	names   []string
+	written [][]byte
+}
+
+// ips returns the sender addresses of the arp frames written, sorted as the
+// interfaces of a round are sent side by side.
+func (l *testLinks) ips() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var ips []string
+	for _, data := range l.written {
+		ips = append(ips, net.IP(data[28:32]).String())
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// setUpRounds has the informers hold vmis and the rounds run under cfg,
+// without state, sync wait nor ownership check, and write on the links it
+// returns. The returned function restores what it replaced.
+func setUpRounds(cfg *config.Config, vmis ...testVMI) (*testLinks, func()) {
+	recorders := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	vmiInformer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v1.VirtualMachineInstance{}, 0, cache.Indexers{})
+	for _, v := range vmis {
+		recorders.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: v.name},
+			IPLists: []v2.IPRecorderIPLists{{IPAddress: v.ip, Vlan: v.vlan, Gateway: v.gateway}}})
+		vmi := &v1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: v.name, UID: types.UID(v.name)}}
+		vmi.Status.NodeName = "node-a"
+		vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+			{InterfaceName: "eth0", MAC: v.mac, IP: v.ip, IPs: []string{v.ip}},
+		}
+		vmiInformer.GetIndexer().Add(vmi)
+	}
+	savedRecorders, savedVirt, savedHost, savedOpen := ipam.RecorderInformer, VirtInformer, HOST_NAME, announce.OpenLink
+	ipam.RecorderInformer, VirtInformer, HOST_NAME = recorders, vmiInformer, "node-a"
+	cfg.StateDir, cfg.SyncWaitTimeout.Duration, cfg.VerifyOwnership = "", 0, false
+	config.Set(cfg)
+	links := &testLinks{}
+	announce.OpenLink = func(name string) (announce.Link, error) {
+		links.mu.Lock()
+		links.names = append(links.names, name)
+		links.mu.Unlock()
+		return fakeLink{written: &links.written, mu: &links.mu}, nil
+	}
+	return links, func() {
+		ipam.RecorderInformer, VirtInformer, HOST_NAME, announce.OpenLink = savedRecorders, savedVirt, savedHost, savedOpen
+		config.Set(config.Default())
+	}
+}
+
+// fakeQMP plans an announce-self per VMI and fails it for vm2.
+type fakeQMP struct {
+	mu        sync.Mutex
+	announced map[string]bool
+}
+
+func (*fakeQMP) Name() string {
+	return config.AnnouncerQMP
+}
+
+func (*fakeQMP) Plan(cfg *config.Config, t plan.Target) *plan.Plan {
+	return &plan.Plan{Frames: []plan.Frame{{Namespace: t.Namespace, VMI: t.VMI, Kind: config.AnnouncerQMP}}}
+}
+
+func (q *fakeQMP) Send(ctx context.Context, cfg *config.Config, frame plan.Frame) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.announced[frame.VMI] = true
+	if frame.VMI == "vm2" {
+		return 0, fmt.Errorf("no qmp socket")
+	}
+	return 1, nil
+}
+
+func TestWithinPools(t *testing.T) {
+	cp := &checkpoint.Checkpoint{Cidrs: map[int][]string{100: {"10.0.0.0/24"}}}
+	targets, skipped := withinPools(cp, []plan.Target{
+		{VMI: "tap0", Interface: "tap0", MAC: "02:00:00:00:00:01", IPs: []string{"10.0.0.2", "192.168.0.2"}, Vlan: 100},
+		{VMI: "tap1", Interface: "tap1", MAC: "02:00:00:00:00:02", IPs: []string{"10.0.0.3"}, Vlan: 200},
+	})
+	if len(targets) != 2 || !reflect.DeepEqual(targets[0].IPs, []string{"10.0.0.2"}) || len(targets[1].IPs) != 0 {
+		t.Errorf("unexpected targets %+v", targets)
+	}
+	if len(skipped) != 2 || skipped[0].IP != "192.168.0.2" || skipped[1].IP != "10.0.0.3" || !skipped[0].Refused() {
+		t.Errorf("unexpected skips %+v", skipped)
+	}
+}
+
+func TestAnnouncers(t *testing.T) {
+	recorders := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	vmis := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v1.VirtualMachineInstance{}, 0, cache.Indexers{})
+	for i, name := range []string{"vm1", "vm2"} {
+		ip := fmt.Sprintf("10.0.0.%d", i+2)
+		recorders.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: name}, IPLists: []v2.IPRecorderIPLists{{IPAddress: ip, Vlan: 100}}})
+		vmi := &v1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name)}}
+		vmi.Status.NodeName = "node-a"
+		vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+			{InterfaceName: "eth0", MAC: fmt.Sprintf("02:00:00:00:00:0%d", i+1), IP: ip, IPs: []string{ip}},
+		}
+		vmis.GetIndexer().Add(vmi)
+	}
+	ipam.RecorderInformer = recorders
+	VirtInformer, HOST_NAME = vmis, "node-a"
+	defer func() { VirtInformer = nil }()
+	cfg := config.Default()
+	cfg.StateDir, cfg.SyncWaitTimeout.Duration, cfg.VerifyOwnership = "", 0, false
+	cfg.Announcers = []string{config.AnnouncerGarpReply, config.AnnouncerGarpRequest, config.AnnouncerQMP}
+	config.Set(cfg)
+	defer config.Set(config.Default())
+
+	var mu sync.Mutex
+	var written [][]byte
+	savedOpen := announce.OpenLink
+	defer func() { announce.OpenLink = savedOpen }()
+	announce.OpenLink = func(name string) (announce.Link, error) {
+		if name != "vlan100" {
+			return nil, fmt.Errorf("unexpected link %s", name)
+		}
+		return fakeLink{written: &written, mu: &mu}, nil
+	}
+	savedQMP, _ := announce.Get(config.AnnouncerQMP)
+	defer announce.Register(savedQMP)
+	qmp := &fakeQMP{announced: map[string]bool{}}
+	announce.Register(qmp)
+
+	report := OnBondFailOver(context.Background(), Cause{Source: SourceNetlink, At: time.Now()})
+	if !qmp.announced["vm1"] || !qmp.announced["vm2"] {
+		t.Errorf("every vmi should be announced by qemu: %v", qmp.announced)
+	}
+	if report.Sent != 5 || report.Failed != 1 || report.Result() != "PartiallyFailed" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	var results []string
+	for _, a := range report.Announcers {
+		results = append(results, fmt.Sprintf("%s %d/%d", a.Name, a.Sent, a.Failed))
+	}
+	sort.Strings(results)
+	if want := []string{"garp-reply 2/0", "garp-request 2/0", "qmp-announce-self 1/1"}; !reflect.DeepEqual(results, want) {
+		t.Errorf("announcer results = %q, want %q", results, want)
+	}
+	// the reply of each interface goes out before its request
+	ops := map[string][]byte{}
+	for _, data := range written {
+		ip := net.IP(data[28:32]).String()
+		ops[ip] = append(ops[ip], data[21])
+	}
+	for _, ip := range []string{"10.0.0.2", "10.0.0.3"} {
+		if !reflect.DeepEqual(ops[ip], []byte{2, 1}) {
+			t.Errorf("arp operations for %s = %v, want reply then request", ip, ops[ip])
+		}
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	recorders := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	vmis := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v1.VirtualMachineInstance{}, 0, cache.Indexers{})
+	annotations := []map[string]string{
+		{plan.AnnotationExtraBursts: "1"},
+		{plan.AnnotationPriority: "10"},
+		{plan.AnnotationAnnounce: "false"},
+	}
+	for i, name := range []string{"web", "db", "vrrp"} {
+		ip := fmt.Sprintf("10.0.0.%d", i+2)
+		recorders.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: name}, IPLists: []v2.IPRecorderIPLists{{IPAddress: ip, Vlan: 100}}})
+		vmi := &v1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name), Annotations: annotations[i]}}
+		vmi.Status.NodeName = "node-a"
+		vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+			{InterfaceName: "eth0", MAC: fmt.Sprintf("02:00:00:00:00:0%d", i+1), IP: ip, IPs: []string{ip}},
+		}
+		vmis.GetIndexer().Add(vmi)
+	}
+	ipam.RecorderInformer = recorders
+	VirtInformer, HOST_NAME = vmis, "node-a"
+	defer func() { VirtInformer = nil }()
+	cfg := config.Default()
+	cfg.StateDir, cfg.SyncWaitTimeout.Duration, cfg.RARPInterval.Duration, cfg.VerifyOwnership = "", 0, 0, false
+	cfg.Announcers = []string{config.AnnouncerGarpRequest}
+	config.Set(cfg)
+	defer config.Set(config.Default())
+
+	var mu sync.Mutex
+	var written [][]byte
+	savedOpen := announce.OpenLink
+	defer func() { announce.OpenLink = savedOpen }()
+	announce.OpenLink = func(name string) (announce.Link, error) {
+		return fakeLink{written: &written, mu: &mu}, nil
+	}
+
+	report := OnBondFailOver(context.Background(), Cause{Source: SourceNetlink, At: time.Now()})
+	var ips []string
+	for _, data := range written {
+		ips = append(ips, net.IP(data[28:32]).String())
+	}
+	// db goes first, web twice for its extra burst, vrrp opts out
+	if want := []string{"10.0.0.3", "10.0.0.2", "10.0.0.2"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("written %q, want %q", ips, want)
+	}
+	if report.Sent != 2 || report.Failed != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+func TestCheckConflicts(t *testing.T) {
+	saved := checkAddresses
+	defer func() { checkAddresses = saved }()
+	var probed []conflict.Probe
+	checkAddresses = func(ctx context.Context, cfg *config.Config, probes []conflict.Probe) ([]conflict.Conflict, error) {
+		probed = probes
+		return []conflict.Conflict{{Probe: probes[1], By: "02:00:00:00:00:99"}}, nil
+	}
+	frame := func(kind, intf, ip, mac string) plan.Frame {
+		return plan.Frame{Namespace: "default", VMI: "vm1", Interface: intf, Bridge: "vlan100", Kind: kind, IP: ip, MAC: mac, Data: []byte{1}}
+	}
+	p := &plan.Plan{Frames: []plan.Frame{
+		frame(config.AnnouncerGarpRequest, "eth0", "10.0.0.2", "02:00:00:00:00:01"),
+		frame(config.AnnouncerGarpRequest, "eth1", "10.0.0.3", "02:00:00:00:00:02"),
+		frame(config.AnnouncerGarpReply, "eth1", "10.0.0.3", "02:00:00:00:00:02"),
+		frame(config.AnnouncerRARP, "eth1", "", "02:00:00:00:00:02"),
+	}}
+	checkConflicts(context.Background(), config.Default(), []*plan.Plan{p})
+
+	if len(probed) != 2 {
+		t.Errorf("each address should be probed once: %+v", probed)
+	}
+	var kinds []string
+	for _, f := range p.Frames {
+		kinds = append(kinds, f.Kind+" "+f.IP)
+	}
+	if want := []string{"garp-request 10.0.0.2", "rarp "}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("frames = %q, want %q", kinds, want)
+	}
+	if len(p.Skipped) != 1 || p.Skipped[0].Reason != plan.ReasonAddressConflict || p.Skipped[0].IP != "10.0.0.3" || p.Skipped[0].Expected() {
+		t.Errorf("the conflicting address should be an unexpected skip: %+v", p.Skipped)
+	}
+}
+
+func TestGatewayRetry(t *testing.T) {
+	cfg := config.Default()
+	cfg.Announcers = []string{config.AnnouncerGarpRequest}
+	cfg.GatewayCheck, cfg.GatewayRetries = true, 2
+	links, restore := setUpRounds(cfg,
+		testVMI{name: "vm1", mac: "02:00:00:00:00:01", ip: "10.0.0.2", gateway: "10.0.0.1", vlan: 100},
+		testVMI{name: "vm2", mac: "02:00:00:00:00:02", ip: "10.0.1.2", gateway: "10.0.1.1", vlan: 200})
+	defer restore()
+
+	savedCheck := checkGateways
+	defer func() { checkGateways = savedCheck }()
+	var asked [][]string
+	checkGateways = func(ctx context.Context, cfg *config.Config, gateways []reachability.Gateway) []reachability.Result {
+		var round []string
+		var results []reachability.Result
+		for _, g := range gateways {
+			round = append(round, g.Bridge+" "+g.Gateway+" for "+g.IP)
+			// the gateway of vlan 200 only replies once announced again
+			results = append(results, reachability.Result{Gateway: g, Slave: "eth1", Reachable: g.Vlan != 200 || len(asked) > 0})
+		}
+		sort.Strings(round)
+		asked = append(asked, round)
+		return results
+	}
+
+	report := OnBondFailOver(context.Background(), Cause{Source: SourceNetlink, At: time.Now()})
+	want := [][]string{
+		{"vlan100 10.0.0.1 for 10.0.0.2", "vlan200 10.0.1.1 for 10.0.1.2"},
+		{"vlan200 10.0.1.1 for 10.0.1.2"},
+	}
+	if !reflect.DeepEqual(asked, want) {
+		t.Errorf("gateways asked %q, want %q", asked, want)
+	}
+	if ips, want := links.ips(), []string{"10.0.0.2", "10.0.1.2", "10.0.1.2"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("written %q, want vlan 200 announced again", ips)
+	}
+	reachable := map[int]bool{}
+	for _, r := range report.GatewayResults() {
+		reachable[r.Vlan] = r.Reachable
+	}
+	if want := map[int]bool{100: true, 200: false}; !reflect.DeepEqual(reachable, want) {
+		t.Errorf("the first round should report vlan 200 unreachable: %v", reachable)
+	}
+}
+
+func TestTrafficCheck(t *testing.T) {
+	cfg := config.Default()
+	cfg.Announcers = []string{config.AnnouncerGarpRequest}
+	cfg.TrafficCheck, cfg.TrafficWindow.Duration, cfg.TrafficRetries = true, time.Millisecond, 2
+	links, restore := setUpRounds(cfg,
+		testVMI{name: "vm1", mac: "02:00:00:00:00:01", ip: "10.0.0.2", vlan: 100},
+		testVMI{name: "vm2", mac: "02:00:00:00:00:02", ip: "10.0.0.3", vlan: 100})
+	defer restore()
+
+	savedCounters, savedPorts, savedHooks := readCounters, lookupPorts, roundHooks
+	defer func() { readCounters, lookupPorts, roundHooks = savedCounters, savedPorts, savedHooks }()
+	lookupPorts = func(cfg *config.Config) (map[string]string, error) {
+		return map[string]string{"02:00:00:00:00:01": "tap0", "02:00:00:00:00:02": "tap1"}, nil
+	}
+	// vm1 sends from the first window on, vm2 never
+	samples := 0
+	readCounters = func() (traffic.Counters, error) {
+		samples++
+		return traffic.Counters{"tap0": uint64(samples), "tap1": 7}, nil
+	}
+	var sources []string
+	roundHooks = nil
+	OnRound(func(r *Report) { sources = append(sources, r.Cause.Source) })
+
+	report := OnBondFailOver(context.Background(), Cause{Source: SourceNetlink, At: time.Now()})
+	if want := []string{"default/vm2"}; !reflect.DeepEqual(report.Unrecovered, want) {
+		t.Errorf("unrecovered = %q, want %q", report.Unrecovered, want)
+	}
+	if ips, want := links.ips(), []string{"10.0.0.2", "10.0.0.3", "10.0.0.3", "10.0.0.3"}; !reflect.DeepEqual(ips, want) {
+		t.Errorf("written %q, want vm2 announced again twice", ips)
+	}
+	if samples != 4 {
+		t.Errorf("sampled the counters %d times, want before the round and after each of its 3 windows", samples)
+	}
+	if want := []string{SourceNetlink, SourceTrafficCheck, SourceTrafficCheck}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("published rounds %q, want %q", sources, want)
+	}
+}
+
+func TestAnnounceVlan(t *testing.T) {
+	cfg := config.Default()
+	cfg.Announcers = []string{config.AnnouncerGarpRequest, config.AnnouncerRARP}
+	links, restore := setUpRounds(cfg,
+		testVMI{name: "vm1", mac: "02:00:00:00:00:01", ip: "10.0.0.2", vlan: 100},
+		testVMI{name: "vm2", mac: "02:00:00:00:00:02", ip: "10.0.1.2", vlan: 200})
+	defer restore()
+
+	report := Announce(context.Background(), Cause{Source: SourceGateway, Vlan: 200}, nil)
+	for _, link := range links.names {
+		if link != "vlan200" {
+			t.Errorf("a round scoped to vlan 200 wrote on %s", link)
+		}
+	}
+	if want := []string{"default/vm2"}; !reflect.DeepEqual(report.Announced(), want) || report.Sent != 2 {
+		t.Errorf("announced %q with %d frames, want %q with the garp and the rarp", report.Announced(), report.Sent, want)
+	}
+}
@@ -0,0 +1,259 @@
+package failover
+
+import (
+	"fmt"
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/pkg/events"
+	"ha-bridge/pkg/plan"
+	"ha-bridge/pkg/reachability"
+	k8sv1 "k8s.io/api/core/v1"
+	v1 "kubevirt.io/client-go/api/v1"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of one failover round.
+type Report struct {
+	Cause    Cause
+	Duration time.Duration
+	VMIs     []*VMIReport
+	Sent     int
+	Failed   int
+	// DryRun is set when the round wrote none of the frames of its plan.
+	DryRun bool
+	// Plan lists the frames of the round and what it skipped.
+	Plan *plan.Plan
+	// FromCheckpoint is set when the informers had not synced and the round
+	// announced the VMIs of the checkpoint saved at CheckpointTime.
+	FromCheckpoint bool
+	CheckpointTime time.Time
+	// FromDiscovery is set when there was no checkpoint either and the round
+	// announced what discovery found on the bridges.
+	FromDiscovery bool
+	// Announcers is what each announcer sent, in the order they first sent.
+	Announcers []*AnnouncerReport
+	// Gateways is the gateway check of each vlan announced on, when enabled.
+	Gateways []reachability.Result
+	// Unrecovered lists the VMIs that sent no unicast packets after the
+	// round and its re-announcements, as namespace/name, when the traffic is
+	// checked.
+	Unrecovered []string
+}
+
+// AnnouncerReport is what one announcer sent in a round.
+type AnnouncerReport struct {
+	Name   string
+	Sent   int
+	Failed int
+}
+
+// VMIReport is what a round announced for one VMI. Sent and Failed count
+// the frames and the announce-self commands.
+type VMIReport struct {
+	Namespace  string
+	Name       string
+	Bridges    []string
+	IPs        []string
+	Sent       int
+	Failed     int
+	Errors     []string
+	Announcers []*AnnouncerReport
+
+	vmi *v1.VirtualMachineInstance
+}
+
+func newVMIReport(vmi *v1.VirtualMachineInstance) *VMIReport {
+	return &VMIReport{Namespace: vmi.Namespace, Name: vmi.Name, vmi: vmi}
+}
+
+func (r *VMIReport) addBridge(bridge string) {
+	for _, b := range r.Bridges {
+		if b == bridge {
+			return
+		}
+	}
+	r.Bridges = append(r.Bridges, bridge)
+}
+
+// addResult counts a frame the announcer name sent, or failed to with err.
+func (r *VMIReport) addResult(name string, err error) {
+	a := announcerReport(&r.Announcers, name)
+	if err != nil {
+		r.Failed++
+		a.Failed++
+		return
+	}
+	r.Sent++
+	a.Sent++
+}
+
+// AnnouncerResults returns what each announcer sent in the round, as the
+// status of the API objects shows it.
+func (r *Report) AnnouncerResults() []v1alpha1.AnnouncerResult {
+	var results []v1alpha1.AnnouncerResult
+	for _, a := range r.Announcers {
+		results = append(results, v1alpha1.AnnouncerResult{Name: a.Name, Sent: a.Sent, Failed: a.Failed})
+	}
+	return results
+}
+
+// GatewayResults returns the gateway checks of the round, as the status of
+// the API objects shows them.
+func (r *Report) GatewayResults() []v1alpha1.GatewayCheck {
+	var results []v1alpha1.GatewayCheck
+	for _, g := range r.Gateways {
+		results = append(results, v1alpha1.GatewayCheck{Vlan: g.Vlan, Bridge: g.Bridge, Gateway: g.Gateway.Gateway,
+			Slave: g.Slave, Reachable: g.Reachable, Error: g.Error})
+	}
+	return results
+}
+
+// unreachable returns the vlans whose gateway was asked but did not reply.
+// Those that could not be checked are left out, as announcing them again
+// changes nothing.
+func (r *Report) unreachable() map[int]bool {
+	vlans := map[int]bool{}
+	for _, g := range r.Gateways {
+		if !g.Reachable && g.Error == "" {
+			vlans[g.Vlan] = true
+		}
+	}
+	return vlans
+}
+
+// announcerReport returns the report of the announcer name in reports,
+// adding it when missing.
+func announcerReport(reports *[]*AnnouncerReport, name string) *AnnouncerReport {
+	for _, a := range *reports {
+		if a.Name == name {
+			return a
+		}
+	}
+	a := &AnnouncerReport{Name: name}
+	*reports = append(*reports, a)
+	return a
+}
+
+func (r *VMIReport) addIP(ip string) {
+	for _, i := range r.IPs {
+		if i == ip {
+			return
+		}
+	}
+	r.IPs = append(r.IPs, ip)
+}
+
+// Result summarises the round in a word.
+func (r *Report) Result() string {
+	switch {
+	case r.DryRun:
+		return "DryRun"
+	case r.Sent == 0 && r.Failed == 0:
+		return "NothingToAnnounce"
+	case r.Failed == 0:
+		return "Succeeded"
+	case r.Sent == 0:
+		return "Failed"
+	default:
+		return "PartiallyFailed"
+	}
+}
+
+// Announced lists the VMIs the round sent frames for, as namespace/name.
+func (r *Report) Announced() []string {
+	var result []string
+	for _, vmi := range r.VMIs {
+		if vmi.Sent > 0 {
+			result = append(result, vmi.Namespace+"/"+vmi.Name)
+		}
+	}
+	return result
+}
+
+// Errors lists up to max errors of the round, prefixed with their VMI.
+func (r *Report) Errors(max int) []string {
+	var result []string
+	for _, vmi := range r.VMIs {
+		for _, err := range vmi.Errors {
+			if len(result) == max {
+				return result
+			}
+			result = append(result, fmt.Sprintf("%s/%s: %s", vmi.Namespace, vmi.Name, err))
+		}
+	}
+	return result
+}
+
+// recordEvents records one event on the node for the round and at most one
+// on each VMI it touched per round, all rate limited by the token bucket of
+// the events package.
+func (r *Report) recordEvents() {
+	eventtype := k8sv1.EventTypeNormal
+	if r.Failed > 0 {
+		eventtype = k8sv1.EventTypeWarning
+	}
+	reason, cause := events.ReasonBondFailover, r.Cause.Source
+	if r.Cause.Bond != "" {
+		cause = fmt.Sprintf("%s on %s (active slave %q -> %q)", r.Cause.Source, r.Cause.Bond, r.Cause.OldSlave, r.Cause.NewSlave)
+	}
+	if r.Cause.Request != "" {
+		reason, cause = events.ReasonScopedAnnounce, fmt.Sprintf("%s %s", r.Cause.Source, r.Cause.Request)
+	}
+	if r.Cause.Vlan != 0 {
+		reason, cause = events.ReasonScopedAnnounce, fmt.Sprintf("%s on vlan %d", cause, r.Cause.Vlan)
+	}
+	if r.FromCheckpoint {
+		cause = fmt.Sprintf("%s, from the checkpoint of %s", cause, r.CheckpointTime.Format(time.RFC3339))
+	}
+	if r.FromDiscovery {
+		cause = fmt.Sprintf("%s, from bridge discovery", cause)
+	}
+	if r.DryRun {
+		events.Node(eventtype, events.ReasonDryRun, "dry-run round triggered by %s: %d vmi, %d frames planned, %d skipped",
+			cause, len(r.VMIs), len(r.Plan.Frames), len(r.Plan.Skipped))
+		return
+	}
+	events.Node(eventtype, reason, "announcement round triggered by %s: %s, %d vmi, %d frames sent, %d failed",
+		cause, r.Result(), len(r.VMIs), r.Sent, r.Failed)
+	var unreachable []string
+	for _, g := range r.Gateways {
+		if !g.Reachable {
+			unreachable = append(unreachable, g.String())
+		}
+	}
+	if len(unreachable) > 0 {
+		events.Node(k8sv1.EventTypeWarning, events.ReasonGatewayUnreachable, "after the round triggered by %s: %s",
+			cause, strings.Join(unreachable, "; "))
+	}
+	// discovery names the VMIs after their bridge ports, which are no objects
+	// to record events on
+	if r.FromDiscovery {
+		var ports []string
+		for _, name := range r.Unrecovered {
+			ports = append(ports, strings.TrimPrefix(name, "/"))
+		}
+		if len(ports) > 0 {
+			events.Node(k8sv1.EventTypeWarning, events.ReasonTrafficNotResumed, "after the round triggered by %s, the traffic of ports %s did not resume",
+				cause, strings.Join(ports, ", "))
+		}
+		return
+	}
+	unrecovered := map[string]bool{}
+	for _, name := range r.Unrecovered {
+		unrecovered[name] = true
+	}
+	for _, vmi := range r.VMIs {
+		bridges := strings.Join(vmi.Bridges, ", ")
+		switch {
+		case vmi.Failed > 0 || len(vmi.Errors) > 0:
+			events.VMI(vmi.vmi, k8sv1.EventTypeWarning, events.ReasonAnnounceFailed, "announced %s on %s with %d frames, %d failed: %s",
+				strings.Join(vmi.IPs, ", "), bridges, vmi.Sent, vmi.Failed, strings.Join(vmi.Errors, "; "))
+		case unrecovered[vmi.Namespace+"/"+vmi.Name]:
+			events.VMI(vmi.vmi, k8sv1.EventTypeWarning, events.ReasonTrafficNotResumed, "announced %s on %s with %d frames, the traffic did not resume after the round and its re-announcements",
+				strings.Join(vmi.IPs, ", "), bridges, vmi.Sent)
+		case vmi.Sent > 0:
+			events.VMI(vmi.vmi, k8sv1.EventTypeNormal, events.ReasonAnnounced, "announced %s on %s with %d frames",
+				strings.Join(vmi.IPs, ", "), bridges, vmi.Sent)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package garp
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+	"time"
+)
+
+// captureTimeout bounds each read of a capture so that a wait for an answer
+// ends on time on a quiet link.
+const captureTimeout = 10 * time.Millisecond
+
+// Capture writes frames on a link and reads the traffic it sees, as a pcap
+// handle does.
+type Capture interface {
+	PacketWriter
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	Close()
+}
+
+// OpenCapture opens link to write requests and read what filter lets
+// through of their answers. The link is put in promiscuous mode, without
+// which it only passes up the answers sent to its own mac, while they are
+// sent to the mac of a vm.
+func OpenCapture(link string, snapLen int32, filter string) (Capture, error) {
+	handle, err := pcap.OpenLive(link, snapLen, true, captureTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if err := handle.SetBPFFilter(filter); err != nil {
+		handle.Close()
+		return nil, err
+	}
+	return handle, nil
+}
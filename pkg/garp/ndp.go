@@ -0,0 +1,49 @@
+package garp
+
+import (
+	"fmt"
+	"github.com/google/gopacket/layers"
+	"net"
+)
+
+// allNodes is the link-local all-nodes multicast group, and allNodesMAC the
+// ethernet address it maps to.
+var (
+	allNodes    = net.ParseIP("ff02::1")
+	allNodesMAC = net.HardwareAddr{0x33, 0x33, 0x00, 0x00, 0x00, 0x01}
+)
+
+// naOverride is the override flag of a neighbor advertisement.
+const naOverride = 0x20
+
+// NewUnsolicitedNA builds the unsolicited neighbor advertisement of RFC 4861
+// announcing ip at mac to all nodes, overriding the caches that knew ip at
+// another address.
+func NewUnsolicitedNA(ip net.IP, mac net.HardwareAddr) ([]byte, error) {
+	if ip.To4() != nil || ip.To16() == nil {
+		return nil, fmt.Errorf("%s is not an ipv6 address", ip)
+	}
+	ipLayer := &layers.IPv6{
+		Version:    6,
+		NextHeader: layers.IPProtocolICMPv6,
+		HopLimit:   255,
+		SrcIP:      ip,
+		DstIP:      allNodes,
+	}
+	icmpLayer := &layers.ICMPv6{
+		TypeCode: layers.CreateICMPv6TypeCode(layers.ICMPv6TypeNeighborAdvertisement, 0),
+	}
+	if err := icmpLayer.SetNetworkLayerForChecksum(ipLayer); err != nil {
+		return nil, err
+	}
+	return serialize(
+		&layers.Ethernet{SrcMAC: mac, DstMAC: allNodesMAC, EthernetType: layers.EthernetTypeIPv6},
+		ipLayer,
+		icmpLayer,
+		&layers.ICMPv6NeighborAdvertisement{
+			Flags:         naOverride,
+			TargetAddress: ip,
+			Options:       layers.ICMPv6Options{{Type: layers.ICMPv6OptTargetAddress, Data: mac}},
+		},
+	)
+}
@@ -0,0 +1,34 @@
+package garp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestNewUnsolicitedNA(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	ip := net.ParseIP("fd00::2")
+	data, err := NewUnsolicitedNA(ip, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	ip6, ok := packet.Layer(layers.LayerTypeIPv6).(*layers.IPv6)
+	if !ok || ip6.HopLimit != 255 || !ip6.SrcIP.Equal(ip) || ip6.DstIP.String() != "ff02::1" {
+		t.Fatalf("unexpected ipv6 header: %v", packet)
+	}
+	na, ok := packet.Layer(layers.LayerTypeICMPv6NeighborAdvertisement).(*layers.ICMPv6NeighborAdvertisement)
+	if !ok || !na.Override() || na.Solicited() || !na.TargetAddress.Equal(ip) {
+		t.Fatalf("not an unsolicited override advertisement for %s: %v", ip, packet)
+	}
+	if len(na.Options) != 1 || na.Options[0].Type != layers.ICMPv6OptTargetAddress || net.HardwareAddr(na.Options[0].Data).String() != mac.String() {
+		t.Errorf("unexpected options %v", na.Options)
+	}
+
+	if _, err := NewUnsolicitedNA(net.ParseIP("10.0.0.2"), mac); err == nil {
+		t.Error("an ipv4 address should be rejected")
+	}
+}
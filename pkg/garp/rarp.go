@@ -0,0 +1,36 @@
+package garp
+
+import (
+	"github.com/google/gopacket/layers"
+	"net"
+)
+
+// EthernetTypeRARP is the ethertype of reverse arp.
+const EthernetTypeRARP layers.EthernetType = 0x8035
+
+// rarpRequestReverse is the reverse request operation of RFC 903.
+const rarpRequestReverse = 3
+
+// NewRARP builds the reverse arp request QEMU's announce_self broadcasts for
+// a guest nic: mac asks for its own address, so that the switches learn where
+// mac is even when the guest has no ip address.
+func NewRARP(mac net.HardwareAddr) ([]byte, error) {
+	unspecified := net.IPv4zero.To4()
+	rarpLayer := &layers.ARP{
+		AddrType:          layers.LinkTypeEthernet,
+		Protocol:          layers.EthernetTypeIPv4,
+		HwAddressSize:     6,
+		ProtAddressSize:   4,
+		Operation:         rarpRequestReverse,
+		DstHwAddress:      mac,
+		DstProtAddress:    []byte(unspecified),
+		SourceHwAddress:   mac,
+		SourceProtAddress: []byte(unspecified),
+	}
+	ethernetLayer := &layers.Ethernet{
+		SrcMAC:       mac,
+		DstMAC:       Broadcast,
+		EthernetType: EthernetTypeRARP,
+	}
+	return serialize(ethernetLayer, rarpLayer)
+}
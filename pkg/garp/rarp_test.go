@@ -0,0 +1,27 @@
+package garp
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestNewRARP(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	data, err := NewRARP(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the 60 bytes announce_self writes: broadcast from mac, ethertype
+	// 0x8035, a reverse request for mac without addresses, zero padding
+	want := []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x52, 0x54, 0x00, 0x12, 0x34, 0x56, 0x80, 0x35,
+		0x00, 0x01, 0x08, 0x00, 0x06, 0x04, 0x00, 0x03,
+		0x52, 0x54, 0x00, 0x12, 0x34, 0x56, 0x00, 0x00, 0x00, 0x00,
+		0x52, 0x54, 0x00, 0x12, 0x34, 0x56, 0x00, 0x00, 0x00, 0x00,
+	}
+	want = append(want, make([]byte, 60-len(want))...)
+	if !bytes.Equal(data, want) {
+		t.Errorf("NewRARP = % x, want % x", data, want)
+	}
+}
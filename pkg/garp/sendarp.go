@@ -1,9 +1,9 @@
 package garp
 
 import (
+	"fmt"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
-	"github.com/google/gopacket/pcap"
 	log "k8s.io/klog/v2"
 	"net"
 	"sync"
@@ -13,46 +13,122 @@ var (
 	handleMutex = sync.Mutex{}
 )
 
+// Broadcast is the ethernet broadcast address gratuitous arps are sent to.
+var Broadcast = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+// PacketWriter writes raw frames, as a pcap handle does.
+type PacketWriter interface {
+	WritePacketData(data []byte) error
+}
+
 //send a arp reply from srcIp to dstIP
-func SendAFakeArpRequest(handle *pcap.Handle, dstIP, srcIP net.IP, dstMac, srcMac net.HardwareAddr) {
-	arpLayer := &layers.ARP{
+func SendAFakeArpRequest(handle PacketWriter, dstIP, srcIP net.IP, dstMac, srcMac net.HardwareAddr) error {
+	outgoingPacket, err := NewArpRequest(dstIP, srcIP, dstMac, srcMac)
+	if err != nil {
+		return err
+	}
+	return Write(handle, outgoingPacket)
+}
+
+// NewGratuitousArp builds the gratuitous arp request announcing ip at mac.
+func NewGratuitousArp(ip net.IP, mac net.HardwareAddr) ([]byte, error) {
+	return NewArpRequest(ip, ip, Broadcast, mac)
+}
+
+// NewGratuitousReply builds the gratuitous arp reply announcing ip at mac.
+func NewGratuitousReply(ip net.IP, mac net.HardwareAddr) ([]byte, error) {
+	return serialize(
+		&layers.Ethernet{SrcMAC: mac, DstMAC: Broadcast, EthernetType: layers.EthernetTypeARP},
+		newArp(layers.ARPReply, ip, ip, Broadcast, mac),
+	)
+}
+
+// NewArpProbe builds the arp probe of RFC 5227 asking whether anyone uses
+// ip: a request from mac with the unspecified sender address, which updates
+// no arp cache.
+func NewArpProbe(ip net.IP, mac net.HardwareAddr) ([]byte, error) {
+	return serialize(
+		&layers.Ethernet{SrcMAC: mac, DstMAC: Broadcast, EthernetType: layers.EthernetTypeARP},
+		newArp(layers.ARPRequest, ip, net.IPv4zero, net.HardwareAddr{0, 0, 0, 0, 0, 0}, mac),
+	)
+}
+
+// NewTaggedGratuitousArp builds the gratuitous arp request announcing ip at
+// mac with the 802.1Q tag of vlan, to be written on the uplink itself.
+func NewTaggedGratuitousArp(ip net.IP, mac net.HardwareAddr, vlan int) ([]byte, error) {
+	return serialize(
+		&layers.Ethernet{SrcMAC: mac, DstMAC: Broadcast, EthernetType: layers.EthernetTypeDot1Q},
+		&layers.Dot1Q{VLANIdentifier: uint16(vlan), Type: layers.EthernetTypeARP},
+		newArp(layers.ARPRequest, ip, ip, Broadcast, mac),
+	)
+}
+
+// NewArpRequest builds the frame of an arp request from srcIP at srcMac for
+// dstIP, sent to dstMac.
+func NewArpRequest(dstIP, srcIP net.IP, dstMac, srcMac net.HardwareAddr) ([]byte, error) {
+	ethernetLayer := &layers.Ethernet{
+		SrcMAC:       srcMac,
+		DstMAC:       dstMac,
+		EthernetType: layers.EthernetTypeARP,
+	}
+	return serialize(ethernetLayer, newArp(layers.ARPRequest, dstIP, srcIP, dstMac, srcMac))
+}
+
+func newArp(operation uint16, dstIP, srcIP net.IP, dstMac, srcMac net.HardwareAddr) *layers.ARP {
+	return &layers.ARP{
 		AddrType:          layers.LinkTypeEthernet,
 		Protocol:          layers.EthernetTypeIPv4,
 		HwAddressSize:     6,
 		ProtAddressSize:   4,
-		Operation:         layers.ARPRequest,
+		Operation:         operation,
 		DstHwAddress:      dstMac,
 		DstProtAddress:    []byte(dstIP.To4()),
 		SourceHwAddress:   srcMac,
 		SourceProtAddress: []byte(srcIP.To4()),
 	}
+}
 
-	ethernetLayer := &layers.Ethernet{
-		SrcMAC:       srcMac,
-		DstMAC:       dstMac,
-		EthernetType: layers.EthernetTypeARP,
-	}
-
-	// And create the packet with the layers
+// serialize builds the frame made of the layers.
+func serialize(l ...gopacket.SerializableLayer) ([]byte, error) {
 	buffer := gopacket.NewSerializeBuffer()
 	opts := gopacket.SerializeOptions{
 		FixLengths:       true,
 		ComputeChecksums: true,
 	}
-	err := gopacket.SerializeLayers(buffer, opts,
-		ethernetLayer,
-		arpLayer,
-	)
+	err := gopacket.SerializeLayers(buffer, opts, l...)
 	if err != nil {
-		log.Error(err)
+		return nil, err
 	}
-	outgoingPacket := buffer.Bytes()
-	log.Infoln("sending arp")
-	//log.Infoln(hex.Dump(outgoingPacket))
+	return buffer.Bytes(), nil
+}
+
+// Write writes the frame data to handle.
+func Write(handle PacketWriter, data []byte) error {
+	log.V(4).Infof("sending %s frame", frameType(data))
 	handleMutex.Lock()
-	err = handle.WritePacketData(outgoingPacket)
+	err := handle.WritePacketData(data)
 	handleMutex.Unlock()
-	if err != nil {
-		log.Error(err)
+	return err
+}
+
+// frameType names the kind of announcement the ethernet frame data is, past
+// a vlan tag.
+func frameType(data []byte) string {
+	offset := 12
+	if len(data) >= offset+6 && layers.EthernetType(uint16(data[offset])<<8|uint16(data[offset+1])) == layers.EthernetTypeDot1Q {
+		offset += 4
+	}
+	if len(data) < offset+2 {
+		return "short"
+	}
+	switch t := layers.EthernetType(uint16(data[offset])<<8 | uint16(data[offset+1])); t {
+	case layers.EthernetTypeARP:
+		return "arp"
+	case EthernetTypeRARP:
+		return "rarp"
+	case layers.EthernetTypeIPv6:
+		return "na"
+	default:
+		return fmt.Sprintf("ethertype %#04x", uint16(t))
 	}
 }
@@ -0,0 +1,71 @@
+package garp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestNewGratuitousReply(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	data, err := NewGratuitousReply(net.ParseIP("10.0.0.2"), mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || arp.Operation != layers.ARPReply || net.IP(arp.SourceProtAddress).String() != "10.0.0.2" ||
+		net.IP(arp.DstProtAddress).String() != "10.0.0.2" || net.HardwareAddr(arp.SourceHwAddress).String() != mac.String() {
+		t.Errorf("not a gratuitous reply for 10.0.0.2: %v", packet)
+	}
+}
+
+func TestNewTaggedGratuitousArp(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	data, err := NewTaggedGratuitousArp(net.ParseIP("10.0.0.2"), mac, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	tag, ok := packet.Layer(layers.LayerTypeDot1Q).(*layers.Dot1Q)
+	if !ok || tag.VLANIdentifier != 100 {
+		t.Fatalf("frame is not tagged with vlan 100: %v", packet)
+	}
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); !ok || arp.Operation != layers.ARPRequest || net.IP(arp.SourceProtAddress).String() != "10.0.0.2" {
+		t.Errorf("not a gratuitous arp for 10.0.0.2: %v", packet)
+	}
+}
+
+func TestNewArpProbe(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	data, err := NewArpProbe(net.ParseIP("10.0.0.2"), mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	eth, _ := packet.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+	arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || eth.DstMAC.String() != Broadcast.String() || arp.Operation != layers.ARPRequest ||
+		!net.IP(arp.SourceProtAddress).Equal(net.IPv4zero) || net.IP(arp.DstProtAddress).String() != "10.0.0.2" ||
+		net.HardwareAddr(arp.SourceHwAddress).String() != mac.String() || net.HardwareAddr(arp.DstHwAddress).String() != "00:00:00:00:00:00" {
+		t.Errorf("not an arp probe for 10.0.0.2: %v", packet)
+	}
+}
+
+func TestFrameType(t *testing.T) {
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	arp, _ := NewGratuitousArp(net.ParseIP("10.0.0.2"), mac)
+	tagged, _ := NewTaggedGratuitousArp(net.ParseIP("10.0.0.2"), mac, 100)
+	rarp, _ := NewRARP(mac)
+	na, _ := NewUnsolicitedNA(net.ParseIP("fd00::2"), mac)
+	for want, data := range map[string][]byte{"arp": arp, "rarp": rarp, "na": na, "short": arp[:10]} {
+		if got := frameType(data); got != want {
+			t.Errorf("frame type %q, want %q", got, want)
+		}
+	}
+	if got := frameType(tagged); got != "arp" {
+		t.Errorf("tagged frame type %q, want arp", got)
+	}
+}
@@ -0,0 +1,175 @@
+// Package gateway watches the gateways of the vlan bridges and has a round
+// announce the vlan whose gateway moves. When the VRRP master of a vlan hands
+// over to another router, or a gateway address starts answering from another
+// mac, the new gateway only learns where the VMs are as their traffic reaches
+// it, which costs a few seconds of asymmetric loss.
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/discovery"
+	"ha-bridge/pkg/events"
+	"ha-bridge/pkg/failover"
+	"ha-bridge/pkg/ipam"
+	"ha-bridge/pkg/metrics"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"net"
+	"time"
+)
+
+const (
+	// gatewayRefresh is how often a watcher reads the gateways of its vlan
+	// from the IPRecorders again.
+	gatewayRefresh = 10 * time.Second
+	// readTimeout bounds each capture read so that a watcher runs the
+	// announcement it holds off on time on a quiet bridge.
+	readTimeout = 100 * time.Millisecond
+)
+
+// The kinds of gateway changes.
+const (
+	KindVRRP = "vrrp"
+	KindARP  = "arp"
+)
+
+// gateways returns the gateways of a vlan; tests replace it.
+var gateways = ipam.Gateways
+
+// Run watches the gateways of every vlan bridge while GatewayWatch is
+// enabled, until ctx is done.
+func Run(ctx context.Context) {
+	discovery.Supervise(ctx, "watch gateways", func(cfg *config.Config) bool { return cfg.GatewayWatch }, watch)
+}
+
+// watch follows the vrrp advertisements and the gateway arp that reach
+// bridge from its uplink, until ctx is done or the bridge goes away. Only the
+// frames received on the uplink port are read: a guest on a tap port could
+// otherwise pose as a new master or gateway mac and have the vlan announced
+// at will. The port is put in promiscuous mode, without which multicast
+// snooping may keep the advertisements from it.
+func watch(ctx context.Context, bridge string, vlan int) error {
+	cfg := config.Get()
+	port, err := discovery.UplinkPort(cfg, bridge)
+	if err != nil {
+		return err
+	}
+	handle, err := pcap.OpenLive(port, cfg.SnapLen, true, readTimeout)
+	if err != nil {
+		return fmt.Errorf("open %s: %v", port, err)
+	}
+	defer handle.Close()
+	if err := handle.SetDirection(pcap.DirectionIn); err != nil {
+		return err
+	}
+	if err := handle.SetBPFFilter("arp or ip proto 112"); err != nil {
+		return err
+	}
+	klog.Infof("watch the gateways of vlan %d on %s of %s", vlan, port, bridge)
+	w := newWatcher(bridge, vlan)
+	for ctx.Err() == nil {
+		data, _, err := handle.ReadPacketData()
+		now := time.Now()
+		switch {
+		case err == nil:
+			w.observe(gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.NoCopy), now)
+		case err != pcap.NextErrorTimeoutExpired:
+			return err
+		}
+		if w.ready(now, config.Get().GatewayHoldoff.Duration) {
+			go failover.Announce(ctx, failover.Cause{Source: failover.SourceGateway, Vlan: vlan}, nil)
+		}
+	}
+	return nil
+}
+
+// watcher follows what one bridge sees of the gateways of its vlan.
+type watcher struct {
+	bridge string
+	vlan   int
+	// known holds the gateway addresses of the vlan, read at refreshed.
+	known     map[string]bool
+	refreshed time.Time
+	// masters is the address of the master of each virtual router, macs
+	// the mac of each gateway address.
+	masters map[uint8]string
+	macs    map[string]string
+	// changed is set when a change waits for its announcement, which is
+	// held off until GatewayHoldoff after announced.
+	changed   bool
+	announced time.Time
+}
+
+func newWatcher(bridge string, vlan int) *watcher {
+	return &watcher{bridge: bridge, vlan: vlan, masters: map[uint8]string{}, macs: map[string]string{}}
+}
+
+// observe records what packet tells of the gateways and reports a change.
+// The first master or mac seen of a gateway is no change.
+func (w *watcher) observe(packet gopacket.Packet, now time.Time) {
+	kind, change := w.compare(packet, now)
+	if change == "" {
+		return
+	}
+	klog.Warning(change)
+	metrics.GatewayChangesTotal.WithLabelValues(w.bridge, kind).Inc()
+	events.Node(k8sv1.EventTypeNormal, events.ReasonGatewayChanged, "%s, announce vlan %d", change, w.vlan)
+	w.changed = true
+}
+
+// compare returns the kind of the change packet shows and a description of
+// it, nothing when it shows none.
+func (w *watcher) compare(packet gopacket.Packet, now time.Time) (string, string) {
+	if vrrp, ok := packet.Layer(layers.LayerTypeVRRP).(*layers.VRRPv2); ok {
+		ip, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		// a master leaving the router advertises priority 0, the next one
+		// takes over with an advertisement of its own
+		if !ok || vrrp.Priority == 0 {
+			return "", ""
+		}
+		master := ip.SrcIP.String()
+		old, seen := w.masters[vrrp.VirtualRtrID]
+		w.masters[vrrp.VirtualRtrID] = master
+		if !seen || old == master {
+			return "", ""
+		}
+		return KindVRRP, fmt.Sprintf("vrrp master of router %d on %s moved from %s to %s", vrrp.VirtualRtrID, w.bridge, old, master)
+	}
+	arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+	if !ok || len(arp.SourceProtAddress) != 4 || len(arp.SourceHwAddress) != 6 {
+		return "", ""
+	}
+	if now.Sub(w.refreshed) >= gatewayRefresh {
+		w.known = map[string]bool{}
+		for _, gateway := range gateways(w.vlan) {
+			w.known[gateway] = true
+		}
+		w.refreshed = now
+	}
+	gateway := net.IP(arp.SourceProtAddress).String()
+	if !w.known[gateway] {
+		return "", ""
+	}
+	mac := net.HardwareAddr(arp.SourceHwAddress).String()
+	old, seen := w.macs[gateway]
+	w.macs[gateway] = mac
+	if !seen || old == mac {
+		return "", ""
+	}
+	return KindARP, fmt.Sprintf("gateway %s on %s moved from mac %s to %s", gateway, w.bridge, old, mac)
+}
+
+// ready tells whether the vlan is to be announced now for the changes seen,
+// holdoff after it last was.
+func (w *watcher) ready(now time.Time, holdoff time.Duration) bool {
+	if !w.changed || now.Sub(w.announced) < holdoff {
+		return false
+	}
+	w.changed, w.announced = false, now
+	return true
+}
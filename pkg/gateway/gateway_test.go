@@ -0,0 +1,85 @@
+package gateway
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"ha-bridge/pkg/garp"
+)
+
+// advertisement builds the vrrp advertisement of router id sent by master.
+func advertisement(t *testing.T, id, priority uint8, master string) gopacket.Packet {
+	vrrp := []byte{0x21, id, priority, 1, 0, 1, 0, 0}
+	vrrp = append(vrrp, net.ParseIP("10.0.0.1").To4()...)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true},
+		&layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0x5e, 0, 1, id}, DstMAC: net.HardwareAddr{1, 0, 0x5e, 0, 0, 0x12}, EthernetType: layers.EthernetTypeIPv4},
+		&layers.IPv4{Version: 4, IHL: 5, TTL: 255, Protocol: layers.IPProtocolVRRP, SrcIP: net.ParseIP(master), DstIP: net.ParseIP("224.0.0.18")},
+		gopacket.Payload(vrrp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(buffer.Bytes(), layers.LayerTypeEthernet, gopacket.Default)
+}
+
+// arpFrom builds the gratuitous arp of ip at mac.
+func arpFrom(t *testing.T, ip, mac string) gopacket.Packet {
+	hw, _ := net.ParseMAC(mac)
+	data, err := garp.NewGratuitousReply(net.ParseIP(ip), hw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+}
+
+func TestCompare(t *testing.T) {
+	saved := gateways
+	defer func() { gateways = saved }()
+	gateways = func(vlan int) []string {
+		return []string{"10.0.0.1"}
+	}
+	w := newWatcher("vlan100", 100)
+	now := time.Now()
+	tests := []struct {
+		name   string
+		packet gopacket.Packet
+		kind   string
+	}{
+		{"first master", advertisement(t, 5, 100, "10.0.0.2"), ""},
+		{"same master", advertisement(t, 5, 100, "10.0.0.2"), ""},
+		{"master leaving", advertisement(t, 5, 0, "10.0.0.3"), ""},
+		{"new master", advertisement(t, 5, 100, "10.0.0.3"), KindVRRP},
+		{"other router", advertisement(t, 6, 100, "10.0.0.4"), ""},
+		{"first gateway mac", arpFrom(t, "10.0.0.1", "02:00:00:00:00:01"), ""},
+		{"vm moving", arpFrom(t, "10.0.0.9", "02:00:00:00:00:09"), ""},
+		{"vm moved", arpFrom(t, "10.0.0.9", "02:00:00:00:00:08"), ""},
+		{"gateway moved", arpFrom(t, "10.0.0.1", "02:00:00:00:00:02"), KindARP},
+	}
+	for _, tt := range tests {
+		if kind, change := w.compare(tt.packet, now); kind != tt.kind {
+			t.Errorf("%s: got %q (%s), want %q", tt.name, kind, change, tt.kind)
+		}
+	}
+}
+
+func TestReady(t *testing.T) {
+	w := newWatcher("vlan100", 100)
+	now := time.Now()
+	if w.ready(now, time.Second) {
+		t.Error("nothing changed yet")
+	}
+	w.changed = true
+	if !w.ready(now, time.Second) {
+		t.Error("the first change should be announced at once")
+	}
+	w.changed = true
+	if w.ready(now.Add(500*time.Millisecond), time.Second) {
+		t.Error("a change within the holdoff should wait")
+	}
+	if !w.ready(now.Add(time.Second), time.Second) || w.ready(now.Add(2*time.Second), time.Second) {
+		t.Error("the held off change should be announced once the holdoff ends, and only once")
+	}
+}
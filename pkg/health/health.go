@@ -0,0 +1,169 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s.io/klog/v2"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Subsystem is one part of the agent whose state is reported on the status
+// page and folded into the readiness and liveness probes.
+type Subsystem struct {
+	name string
+	// ready returns why the subsystem is not ready, nil when it is.
+	ready func() error
+	// stall is how long the subsystem may go without calling Progress
+	// before the agent is considered dead, zero when it is not tracked.
+	stall time.Duration
+
+	mu           sync.Mutex
+	lastProgress time.Time
+	lastError    string
+	lastErrorAt  time.Time
+}
+
+// Status is the JSON view of a Subsystem.
+type Status struct {
+	Name         string     `json:"name"`
+	Ready        bool       `json:"ready"`
+	Live         bool       `json:"live"`
+	Message      string     `json:"message,omitempty"`
+	LastProgress *time.Time `json:"lastProgress,omitempty"`
+	LastError    string     `json:"lastError,omitempty"`
+	LastErrorAt  *time.Time `json:"lastErrorAt,omitempty"`
+}
+
+var (
+	registryMutex = sync.Mutex{}
+	registry      = map[string]*Subsystem{}
+)
+
+// Register adds a subsystem, replacing any registered under the same name.
+// Either ready or stall may be left empty.
+func Register(name string, ready func() error, stall time.Duration) *Subsystem {
+	s := &Subsystem{name: name, ready: ready, stall: stall}
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	registry[name] = s
+	return s
+}
+
+// Progress records that the subsystem's loop is still turning.
+func (s *Subsystem) Progress() {
+	s.mu.Lock()
+	s.lastProgress = time.Now()
+	s.mu.Unlock()
+}
+
+// Error records the latest error of the subsystem; nil is ignored.
+func (s *Subsystem) Error(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.lastError = err.Error()
+	s.lastErrorAt = time.Now()
+	s.mu.Unlock()
+}
+
+// Status evaluates the subsystem now.
+func (s *Subsystem) Status() Status {
+	st := Status{Name: s.name, Ready: true, Live: true}
+	if s.ready != nil {
+		if err := s.ready(); err != nil {
+			st.Ready = false
+			st.Message = err.Error()
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.lastProgress.IsZero() {
+		t := s.lastProgress
+		st.LastProgress = &t
+		// a loop that has not started yet is the readiness probe's business
+		if s.stall > 0 && time.Since(t) > s.stall {
+			st.Live = false
+			st.Message = fmt.Sprintf("no progress for %v", time.Since(t).Round(time.Second))
+		}
+	}
+	if s.lastError != "" {
+		t := s.lastErrorAt
+		st.LastError = s.lastError
+		st.LastErrorAt = &t
+	}
+	return st
+}
+
+// Statuses evaluates every registered subsystem, sorted by name.
+func Statuses() []Status {
+	registryMutex.Lock()
+	subsystems := make([]*Subsystem, 0, len(registry))
+	for _, s := range registry {
+		subsystems = append(subsystems, s)
+	}
+	registryMutex.Unlock()
+	result := make([]Status, 0, len(subsystems))
+	for _, s := range subsystems {
+		result = append(result, s.Status())
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+func probe(w http.ResponseWriter, ok func(Status) bool) {
+	var failed []string
+	for _, st := range Statuses() {
+		if !ok(st) {
+			failed = append(failed, fmt.Sprintf("%s: %s", st.Name, st.Message))
+		}
+	}
+	if len(failed) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, f := range failed {
+			fmt.Fprintln(w, f)
+		}
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// Handler serves /healthz for liveness, /readyz for readiness and /status
+// with the detailed state of every subsystem.
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		probe(w, func(st Status) bool { return st.Live })
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		probe(w, func(st Status) bool { return st.Ready })
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(Statuses()); err != nil {
+			klog.Errorf("encode status: %v", err)
+		}
+	})
+	return mux
+}
+
+// Serve exposes Handler on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string) {
+	server := &http.Server{Addr: addr, Handler: Handler()}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	klog.Infof("serve health on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Errorf("health server: %v", err)
+	}
+}
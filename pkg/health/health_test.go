@@ -0,0 +1,50 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProbes(t *testing.T) {
+	registry = map[string]*Subsystem{}
+	var notReady error = errors.New("not synced")
+	informers := Register("informers", func() error { return notReady }, 0)
+	loop := Register("loop", nil, 50*time.Millisecond)
+	informers.Error(errors.New("list failed"))
+
+	server := httptest.NewServer(Handler())
+	defer server.Close()
+	code := func(path string) int {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code("/readyz") != http.StatusServiceUnavailable {
+		t.Fatal("expected not ready while informers are not synced")
+	}
+	if code("/healthz") != http.StatusOK {
+		t.Fatal("a loop that has not started must not fail liveness")
+	}
+	notReady = nil
+	loop.Progress()
+	if code("/readyz") != http.StatusOK || code("/healthz") != http.StatusOK {
+		t.Fatal("expected ready and live")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if code("/healthz") != http.StatusServiceUnavailable {
+		t.Fatal("expected a stalled loop to fail liveness")
+	}
+
+	for _, st := range Statuses() {
+		if st.Name == "informers" && st.LastError != "list failed" {
+			t.Fatalf("unexpected status %+v", st)
+		}
+	}
+}
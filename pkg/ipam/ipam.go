@@ -0,0 +1,193 @@
+package ipam
+
+import (
+	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	"fmt"
+	"ha-bridge/pkg/config"
+	k8sv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	v1 "kubevirt.io/client-go/api/v1"
+	"net"
+	"sort"
+)
+
+// RecorderInformer watches the IPRecorders, indexed by IPAddressIndexFunc.
+var RecorderInformer cache.SharedIndexInformer
+
+// PodInformer watches the virt-launcher pods of the node, by which
+// VerifyOwner tells the addresses recorded under the pod of a VMI.
+var PodInformer cache.SharedIndexInformer
+
+// resourcesPod marks the IPRecorder entries recorded under the pod the
+// address was allocated to, as IPAM does for standalone VMIs and addresses
+// that are not fixed. The fixed addresses of a VM are recorded under the VM,
+// which names its VMI.
+const resourcesPod = "pods"
+
+// IPAddressIndex is the RecorderInformer index built by IPAddressIndexFunc.
+const IPAddressIndex = "ipaddress"
+
+// IPAddressIndexFunc indexes an IPRecorder by every address it still holds,
+// skipping entries that have been released back to the pool.
+func IPAddressIndexFunc(obj interface{}) ([]string, error) {
+	recorder, ok := obj.(*v2.IPRecorder)
+	if !ok {
+		return nil, fmt.Errorf("object is not an IPRecorder: %T", obj)
+	}
+	var result []string
+	for _, entry := range recorder.IPLists {
+		if entry.Released || entry.IPAddress == "" {
+			continue
+		}
+		result = append(result, entry.IPAddress)
+	}
+	return result, nil
+}
+
+// GetIPEntry returns the IPRecorder list entry holding ip, which carries the
+// vlan, cidr, gateway and pool the address was allocated from.
+func GetIPEntry(ip string) (*v2.IPRecorderIPLists, error) {
+	obj, err := RecorderInformer.GetIndexer().ByIndex(IPAddressIndex, ip)
+	if err != nil {
+		return nil, err
+	}
+	var result []v2.IPRecorderIPLists
+	for i := 0; i < len(obj); i++ {
+		recorder, ok := obj[i].(*v2.IPRecorder)
+		if !ok {
+			continue
+		}
+		for _, entry := range recorder.IPLists {
+			if entry.IPAddress == ip && !entry.Released {
+				result = append(result, entry)
+			}
+		}
+	}
+	switch len(result) {
+	case 0:
+		return nil, fmt.Errorf("coun't find ip is %s", ip)
+	case 1:
+		return &result[0], nil
+	default:
+		return nil, fmt.Errorf("ip %s is recorded %d times", ip, len(result))
+	}
+}
+
+// Gateways returns the gateways of the addresses the IPRecorders hold on
+// vlan.
+func Gateways(vlan int) []string {
+	if RecorderInformer == nil {
+		return nil
+	}
+	var result []string
+	seen := map[string]bool{}
+	for _, obj := range RecorderInformer.GetIndexer().List() {
+		recorder, ok := obj.(*v2.IPRecorder)
+		if !ok {
+			continue
+		}
+		for _, entry := range recorder.IPLists {
+			if entry.Released || entry.Vlan != vlan || entry.Gateway == "" || seen[entry.Gateway] {
+				continue
+			}
+			seen[entry.Gateway] = true
+			result = append(result, entry.Gateway)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// CheckInterface resolves the IPRecorder entry and the host bridge a round
+// announces the guest interface intf on under cfg, or says why it does not.
+func CheckInterface(cfg *config.Config, intf v1.VirtualMachineInstanceNetworkInterface) (*v2.IPRecorderIPLists, string, error) {
+	if !cfg.AnnounceInterface(intf.InterfaceName) {
+		return nil, "", fmt.Errorf("interface %q is not announced", intf.InterfaceName)
+	}
+	if intf.IP == "" {
+		return nil, "", fmt.Errorf("interface %q has no ip address", intf.InterfaceName)
+	}
+	entry, err := ResolveIPEntry(intf.IP)
+	if err != nil {
+		return nil, "", err
+	}
+	return entry, cfg.BridgeName(entry.Vlan), nil
+}
+
+// The checks VerifyOwner makes, in order.
+const (
+	// CheckRecorded: an IPRecorder entry holds the address.
+	CheckRecorded = "recorded"
+	// CheckOwner: the entry gives the address to the VMI.
+	CheckOwner = "owner"
+	// CheckPool: the address lies in the cidr of the entry's IPPool.
+	CheckPool = "pool"
+)
+
+// OwnershipError is an address VerifyOwner refuses, and the check it fails.
+type OwnershipError struct {
+	IP    string
+	Check string
+	msg   string
+}
+
+func (e *OwnershipError) Error() string {
+	return e.msg
+}
+
+// VerifyOwner checks that IPAM gave ip to vmi: an IPRecorder entry must hold
+// ip for the VMI, or for its virt-launcher pod, and ip must lie in the cidr
+// of the IPPool of the entry. The pool fallback of ResolveIPEntry does not
+// count, since the pools know nothing of owners.
+func VerifyOwner(ip string, vmi *v1.VirtualMachineInstance) error {
+	refuse := func(check, format string, args ...interface{}) error {
+		return &OwnershipError{IP: ip, Check: check, msg: fmt.Sprintf(format, args...)}
+	}
+	entry, err := GetIPEntry(ip)
+	if err != nil {
+		return refuse(CheckRecorded, "ip %s is not recorded for vmi %s/%s: %v", ip, vmi.Namespace, vmi.Name, err)
+	}
+	if !recordedFor(entry, vmi) {
+		return refuse(CheckOwner, "ip %s is recorded for %s %s/%s, not for vmi %s/%s", ip, entry.Resources, entry.Namespace, entry.Name, vmi.Namespace, vmi.Name)
+	}
+	cidr, ok := poolCidr(entry.Pool)
+	if !ok {
+		return refuse(CheckPool, "ip %s is recorded in unknown ippool %q", ip, entry.Pool)
+	}
+	if addr := net.ParseIP(ip); addr == nil || !cidr.Contains(addr) {
+		return refuse(CheckPool, "ip %s is outside %s of ippool %s", ip, cidr, entry.Pool)
+	}
+	return nil
+}
+
+// recordedFor tells whether entry records its address for vmi. An entry
+// recorded under a pod belongs to the VMI whose virt-launcher pod it is, by
+// the created-by label or an owner reference.
+func recordedFor(entry *v2.IPRecorderIPLists, vmi *v1.VirtualMachineInstance) bool {
+	if entry.Namespace != vmi.Namespace {
+		return false
+	}
+	if entry.Resources != resourcesPod {
+		return entry.Name == vmi.Name
+	}
+	if PodInformer == nil || vmi.UID == "" {
+		return false
+	}
+	obj, exists, err := PodInformer.GetStore().GetByKey(entry.Namespace + "/" + entry.Name)
+	if err != nil || !exists {
+		return false
+	}
+	pod, ok := obj.(*k8sv1.Pod)
+	if !ok {
+		return false
+	}
+	if pod.Labels[v1.CreatedByLabel] == string(vmi.UID) {
+		return true
+	}
+	for _, ref := range pod.OwnerReferences {
+		if ref.UID == vmi.UID {
+			return true
+		}
+	}
+	return false
+}
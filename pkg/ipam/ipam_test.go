@@ -0,0 +1,203 @@
+package ipam
+
+import (
+	"reflect"
+	"testing"
+
+	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	v1 "kubevirt.io/client-go/api/v1"
+)
+
+func newRecorder(name string, entries ...v2.IPRecorderIPLists) *v2.IPRecorder {
+	return &v2.IPRecorder{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		IPLists:    entries,
+	}
+}
+
+func TestIPAddressIndexFunc(t *testing.T) {
+	keys, err := IPAddressIndexFunc(newRecorder("empty"))
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("empty recorder: got %v, %v", keys, err)
+	}
+
+	keys, err = IPAddressIndexFunc(newRecorder("multi",
+		v2.IPRecorderIPLists{IPAddress: "10.0.0.2", Vlan: 100},
+		v2.IPRecorderIPLists{IPAddress: "10.0.1.2", Vlan: 101, Released: true},
+		v2.IPRecorderIPLists{IPAddress: "10.0.2.2", Vlan: 102},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "10.0.0.2" || keys[1] != "10.0.2.2" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
+
+func TestGetIPEntry(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{IPAddressIndex: IPAddressIndexFunc})
+	indexer.Add(newRecorder("vm-a",
+		v2.IPRecorderIPLists{IPAddress: "10.0.0.2", Vlan: 100, Gateway: "10.0.0.1"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.2.2", Vlan: 102, Gateway: "10.0.2.1"},
+	))
+	indexer.Add(newRecorder("vm-b", v2.IPRecorderIPLists{IPAddress: "10.0.2.2", Vlan: 102, Released: true}))
+	RecorderInformer = &fakeInformer{indexer: indexer}
+
+	entry, err := GetIPEntry("10.0.2.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Vlan != 102 || entry.Gateway != "10.0.2.1" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+	if _, err := GetIPEntry("10.0.9.9"); err == nil {
+		t.Fatal("expected error for unknown ip")
+	}
+}
+
+func TestGateways(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{IPAddressIndex: IPAddressIndexFunc})
+	indexer.Add(newRecorder("vm-a",
+		v2.IPRecorderIPLists{IPAddress: "10.0.0.2", Vlan: 100, Gateway: "10.0.0.1"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.2.2", Vlan: 102, Gateway: "10.0.2.1"},
+	))
+	indexer.Add(newRecorder("vm-b",
+		v2.IPRecorderIPLists{IPAddress: "10.0.0.3", Vlan: 100, Gateway: "10.0.0.1"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.0.130", Vlan: 100, Gateway: "10.0.0.129"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.0.4", Vlan: 100, Gateway: "10.0.0.254", Released: true},
+	))
+	RecorderInformer = &fakeInformer{indexer: indexer}
+
+	if got := Gateways(100); len(got) != 2 || got[0] != "10.0.0.1" || got[1] != "10.0.0.129" {
+		t.Errorf("gateways of vlan 100 = %v", got)
+	}
+	if got := Gateways(101); len(got) != 0 {
+		t.Errorf("vlan 101 should have no gateway, got %v", got)
+	}
+}
+
+func TestVlanCidrs(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	indexer.Add(&v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-b"}, Spec: v2.IPPoolSpec{Cidr: "10.0.1.0/24", Vlan: 100}})
+	indexer.Add(&v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-a"}, Spec: v2.IPPoolSpec{Cidr: "10.0.0.0/24", Vlan: 100}})
+	indexer.Add(&v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-c"}, Spec: v2.IPPoolSpec{Cidr: "bogus", Vlan: 101}})
+	saved := PoolInformer
+	defer func() { PoolInformer = saved }()
+	PoolInformer = &fakeInformer{indexer: indexer}
+
+	want := map[int][]string{100: {"10.0.0.0/24", "10.0.1.0/24"}}
+	if got := VlanCidrs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("cidrs = %v, want %v", got, want)
+	}
+}
+
+type fakeInformer struct {
+	cache.SharedIndexInformer
+	indexer cache.Indexer
+}
+
+func (f *fakeInformer) GetIndexer() cache.Indexer { return f.indexer }
+
+func (f *fakeInformer) GetStore() cache.Store { return f.indexer }
+
+func TestResolveIPEntryFallsBackToPool(t *testing.T) {
+	RecorderInformer = &fakeInformer{indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{IPAddressIndex: IPAddressIndexFunc})}
+	pool := &v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-a"}, Spec: v2.IPPoolSpec{Cidr: "10.0.3.0/24", Vlan: 103}}
+	PoolEventHandler.OnAdd(pool)
+	defer PoolEventHandler.OnDelete(pool)
+
+	entry, err := ResolveIPEntry("10.0.3.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Vlan != 103 || entry.Pool != "pool-a" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	moved := pool.DeepCopy()
+	moved.Spec.Cidr = "10.0.4.0/24"
+	PoolEventHandler.OnUpdate(pool, moved)
+	if _, err := ResolveIPEntry("10.0.3.7"); err == nil {
+		t.Fatal("expected stale cidr to be removed")
+	}
+}
+
+func TestPoolsSharingCidr(t *testing.T) {
+	saved := RecorderInformer
+	defer func() { RecorderInformer = saved }()
+	RecorderInformer = &fakeInformer{indexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{IPAddressIndex: IPAddressIndexFunc})}
+	old := &v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-old"}, Spec: v2.IPPoolSpec{Cidr: "10.0.8.0/24", Vlan: 108}}
+	renamed := &v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-new"}, Spec: v2.IPPoolSpec{Cidr: "10.0.8.0/24", Vlan: 108}}
+	PoolEventHandler.OnAdd(old)
+	PoolEventHandler.OnAdd(renamed)
+	defer PoolEventHandler.OnDelete(renamed)
+
+	PoolEventHandler.OnDelete(old)
+	entry, err := ResolveIPEntry("10.0.8.7")
+	if err != nil {
+		t.Fatalf("the cidr should outlive the pool deleted: %v", err)
+	}
+	if entry.Pool != "pool-new" {
+		t.Errorf("resolved to %s, want pool-new", entry.Pool)
+	}
+	if _, ok := poolCidr("pool-new"); !ok {
+		t.Error("pool-new should keep its cidr")
+	}
+
+	PoolEventHandler.OnDelete(renamed)
+	if _, err := ResolveIPEntry("10.0.8.7"); err == nil {
+		t.Error("the cidr should go with the last pool")
+	}
+}
+
+func TestVerifyOwner(t *testing.T) {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{IPAddressIndex: IPAddressIndexFunc})
+	indexer.Add(newRecorder("r",
+		v2.IPRecorderIPLists{IPAddress: "10.0.5.2", Vlan: 105, Pool: "pool-b", Resources: "virtualmachines", Namespace: "default", Name: "vm1"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.5.3", Vlan: 105, Pool: "pool-b", Resources: "virtualmachines", Namespace: "default", Name: "vm2"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.6.2", Vlan: 105, Pool: "pool-b", Resources: "virtualmachines", Namespace: "default", Name: "vm1"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.7.2", Vlan: 107, Pool: "pool-gone", Resources: "virtualmachines", Namespace: "default", Name: "vm1"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.5.4", Vlan: 105, Pool: "pool-b", Resources: "pods", Namespace: "default", Name: "virt-launcher-vm1-abcde"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.5.5", Vlan: 105, Pool: "pool-b", Resources: "pods", Namespace: "default", Name: "virt-launcher-vm1-fghij"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.5.6", Vlan: 105, Pool: "pool-b", Resources: "pods", Namespace: "default", Name: "virt-launcher-vm2-abcde"},
+		v2.IPRecorderIPLists{IPAddress: "10.0.5.7", Vlan: 105, Pool: "pool-b", Resources: "pods", Namespace: "default", Name: "vm1"},
+	))
+	pods := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	pods.Add(&k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "virt-launcher-vm1-abcde",
+		Labels: map[string]string{v1.CreatedByLabel: "uid-vm1"}}})
+	pods.Add(&k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "virt-launcher-vm1-fghij",
+		OwnerReferences: []metav1.OwnerReference{{Kind: "VirtualMachineInstance", Name: "vm1", UID: "uid-vm1"}}}})
+	pods.Add(&k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "virt-launcher-vm2-abcde",
+		Labels: map[string]string{v1.CreatedByLabel: "uid-vm2"}}})
+	savedRecorders, savedPods := RecorderInformer, PodInformer
+	defer func() { RecorderInformer, PodInformer = savedRecorders, savedPods }()
+	RecorderInformer, PodInformer = &fakeInformer{indexer: indexer}, &fakeInformer{indexer: pods}
+	pool := &v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-b"}, Spec: v2.IPPoolSpec{Cidr: "10.0.5.0/24", Vlan: 105}}
+	PoolEventHandler.OnAdd(pool)
+	defer PoolEventHandler.OnDelete(pool)
+
+	vmi := &v1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vm1", UID: "uid-vm1"}}
+	for _, ip := range []string{"10.0.5.2", "10.0.5.4", "10.0.5.5"} {
+		if err := VerifyOwner(ip, vmi); err != nil {
+			t.Errorf("vm1 owns %s: %v", ip, err)
+		}
+	}
+	for _, tt := range []struct {
+		ip, check string
+	}{
+		{"10.0.5.9", CheckRecorded},
+		{"10.0.5.3", CheckOwner},
+		{"10.0.5.6", CheckOwner},
+		{"10.0.5.7", CheckOwner},
+		{"10.0.6.2", CheckPool},
+		{"10.0.7.2", CheckPool},
+	} {
+		err := VerifyOwner(tt.ip, vmi)
+		if oerr, ok := err.(*OwnershipError); !ok || oerr.Check != tt.check || oerr.IP != tt.ip {
+			t.Errorf("%s: got %v, want the %s check to fail", tt.ip, err, tt.check)
+		}
+	}
+}
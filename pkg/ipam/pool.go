@@ -0,0 +1,159 @@
+package ipam
+
+import (
+	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	"fmt"
+	"ha-bridge/pkg/iptree"
+	"ha-bridge/pkg/metrics"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"net"
+	"sort"
+	"sync"
+)
+
+// PoolInformer watches the IPPools, whose cidrs back ResolveIPEntry.
+var PoolInformer cache.SharedIndexInformer
+
+var (
+	poolMutex = sync.Mutex{}
+	poolTree  = iptree.New()
+	// poolCidrs remembers the cidr each pool was inserted under, so an update
+	// that changes spec.cidr removes the stale prefix. pools keeps each pool,
+	// so that a prefix two pools share outlives either of them.
+	poolCidrs = map[string]*net.IPNet{}
+	pools     = map[string]*v2.IPPool{}
+)
+
+// PoolEventHandler keeps the IPPool prefix tree in step with PoolInformer.
+var PoolEventHandler = cache.ResourceEventHandlerFuncs{
+	AddFunc: func(obj interface{}) {
+		addPool(obj)
+	},
+	UpdateFunc: func(oldObj, newObj interface{}) {
+		addPool(newObj)
+	},
+	DeleteFunc: func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		if pool, ok := obj.(*v2.IPPool); ok {
+			deletePool(pool.Name)
+		}
+	},
+}
+
+func addPool(obj interface{}) {
+	pool, ok := obj.(*v2.IPPool)
+	if !ok {
+		return
+	}
+	_, cidr, err := net.ParseCIDR(pool.Spec.Cidr)
+	if err != nil {
+		klog.Errorf("ippool %s has invalid cidr %q: %v", pool.Name, pool.Spec.Cidr, err)
+		deletePool(pool.Name)
+		return
+	}
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	old, moved := poolCidrs[pool.Name]
+	poolCidrs[pool.Name] = cidr
+	pools[pool.Name] = pool.DeepCopy()
+	if moved && old.String() != cidr.String() {
+		refreshCidr(old)
+	}
+	refreshCidr(cidr)
+}
+
+func deletePool(name string) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	if old, ok := poolCidrs[name]; ok {
+		delete(poolCidrs, name)
+		delete(pools, name)
+		refreshCidr(old)
+	}
+}
+
+// refreshCidr points the prefix cidr of poolTree at the first pool by name
+// with that cidr, or removes it when none is left, as while a pool is
+// renamed or migrated the old and the new one share it. poolMutex must be
+// held.
+func refreshCidr(cidr *net.IPNet) {
+	var holder string
+	for name, c := range poolCidrs {
+		if c.String() == cidr.String() && (holder == "" || name < holder) {
+			holder = name
+		}
+	}
+	if holder == "" {
+		poolTree.Delete(cidr)
+		return
+	}
+	poolTree.Insert(cidr, pools[holder])
+}
+
+// poolCidr returns the cidr of the IPPool called name.
+func poolCidr(name string) (*net.IPNet, bool) {
+	poolMutex.Lock()
+	defer poolMutex.Unlock()
+	cidr, ok := poolCidrs[name]
+	return cidr, ok
+}
+
+// VlanCidrs returns the cidrs of the IPPools of each vlan.
+func VlanCidrs() map[int][]string {
+	if PoolInformer == nil {
+		return nil
+	}
+	result := map[int][]string{}
+	for _, obj := range PoolInformer.GetIndexer().List() {
+		pool, ok := obj.(*v2.IPPool)
+		if !ok {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(pool.Spec.Cidr); err != nil {
+			continue
+		}
+		result[pool.Spec.Vlan] = append(result[pool.Spec.Vlan], pool.Spec.Cidr)
+	}
+	for _, cidrs := range result {
+		sort.Strings(cidrs)
+	}
+	return result
+}
+
+// GetPool returns the IPPool whose cidr most specifically contains ip.
+func GetPool(ip string) (*v2.IPPool, error) {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return nil, fmt.Errorf("invalid ip %q", ip)
+	}
+	obj, ok := poolTree.Lookup(addr)
+	if !ok {
+		return nil, fmt.Errorf("no ippool contains ip %s", ip)
+	}
+	return obj.(*v2.IPPool), nil
+}
+
+// ResolveIPEntry looks ip up in the IPRecorders first and falls back to the
+// IPPool containing it when the recorder is missing or lags behind.
+func ResolveIPEntry(ip string) (*v2.IPRecorderIPLists, error) {
+	entry, err := GetIPEntry(ip)
+	if err == nil {
+		return entry, nil
+	}
+	pool, poolErr := GetPool(ip)
+	if poolErr != nil {
+		return nil, fmt.Errorf("%v, %v", err, poolErr)
+	}
+	metrics.VlanFallbackTotal.Inc()
+	klog.Warningf("%v, use vlan %d of ippool %s", err, pool.Spec.Vlan, pool.Name)
+	return &v2.IPRecorderIPLists{
+		Pool:      pool.Name,
+		IPAddress: ip,
+		Gateway:   pool.Spec.Gateway,
+		Vlan:      pool.Spec.Vlan,
+		Cidr:      pool.Spec.Cidr,
+	}, nil
+}
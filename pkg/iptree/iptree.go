@@ -0,0 +1,132 @@
+package iptree
+
+import (
+	"net"
+	"sync"
+)
+
+// Tree is a binary prefix tree keyed by CIDR, answering longest-prefix
+// matches for single addresses. IPv4 prefixes are stored in their IPv4-mapped
+// IPv6 form so both families share one tree.
+type Tree struct {
+	mu   sync.RWMutex
+	root *node
+	size int
+}
+
+type node struct {
+	child [2]*node
+	value interface{}
+	set   bool
+}
+
+func New() *Tree {
+	return &Tree{root: &node{}}
+}
+
+// Insert stores value under cidr, replacing any value already there.
+func (t *Tree) Insert(cidr *net.IPNet, value interface{}) {
+	key, bits := prefixKey(cidr)
+	if key == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.root
+	for i := 0; i < bits; i++ {
+		b := bit(key, i)
+		if n.child[b] == nil {
+			n.child[b] = &node{}
+		}
+		n = n.child[b]
+	}
+	if !n.set {
+		t.size++
+	}
+	n.value = value
+	n.set = true
+}
+
+// Delete removes the value stored under exactly cidr and reports whether
+// there was one.
+func (t *Tree) Delete(cidr *net.IPNet) bool {
+	key, bits := prefixKey(cidr)
+	if key == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	path := make([]*node, 0, bits+1)
+	n := t.root
+	for i := 0; i < bits; i++ {
+		path = append(path, n)
+		n = n.child[bit(key, i)]
+		if n == nil {
+			return false
+		}
+	}
+	if !n.set {
+		return false
+	}
+	n.value = nil
+	n.set = false
+	t.size--
+	// prune the branch that no longer leads to any value
+	for i := bits - 1; i >= 0; i-- {
+		if n.set || n.child[0] != nil || n.child[1] != nil {
+			break
+		}
+		path[i].child[bit(key, i)] = nil
+		n = path[i]
+	}
+	return true
+}
+
+// Lookup returns the value of the most specific prefix containing ip.
+func (t *Tree) Lookup(ip net.IP) (interface{}, bool) {
+	key := ip.To16()
+	if key == nil {
+		return nil, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	var result interface{}
+	found := false
+	n := t.root
+	for i := 0; n != nil; i++ {
+		if n.set {
+			result, found = n.value, true
+		}
+		if i == 8*net.IPv6len {
+			break
+		}
+		n = n.child[bit(key, i)]
+	}
+	return result, found
+}
+
+// Len returns the number of prefixes stored in the tree.
+func (t *Tree) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.size
+}
+
+func prefixKey(cidr *net.IPNet) (net.IP, int) {
+	if cidr == nil {
+		return nil, 0
+	}
+	ones, bits := cidr.Mask.Size()
+	key := cidr.IP.Mask(cidr.Mask).To16()
+	if key == nil || bits == 0 {
+		return nil, 0
+	}
+	if bits == 8*net.IPv4len {
+		ones += 8 * (net.IPv6len - net.IPv4len)
+	}
+	return key, ones
+}
+
+func bit(key net.IP, i int) int {
+	return int(key[i/8]>>(7-uint(i%8))) & 1
+}
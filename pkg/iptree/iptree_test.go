@@ -0,0 +1,66 @@
+package iptree
+
+import (
+	"net"
+	"testing"
+)
+
+func mustCIDR(t *testing.T, s string) *net.IPNet {
+	_, cidr, err := net.ParseCIDR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cidr
+}
+
+func TestLookup(t *testing.T) {
+	tree := New()
+	tree.Insert(mustCIDR(t, "10.0.0.0/8"), "wide")
+	tree.Insert(mustCIDR(t, "10.1.0.0/16"), "narrow")
+	tree.Insert(mustCIDR(t, "fd00::/64"), "v6")
+
+	cases := map[string]interface{}{
+		"10.1.2.3":  "narrow",
+		"10.2.2.3":  "wide",
+		"fd00::10":  "v6",
+		"192.0.2.1": nil,
+		"fd01::1":   nil,
+	}
+	for ip, want := range cases {
+		got, ok := tree.Lookup(net.ParseIP(ip))
+		if want == nil {
+			if ok {
+				t.Errorf("%s: unexpected match %v", ip, got)
+			}
+			continue
+		}
+		if !ok || got != want {
+			t.Errorf("%s: got %v, want %v", ip, got, want)
+		}
+	}
+	if tree.Len() != 3 {
+		t.Fatalf("unexpected len %d", tree.Len())
+	}
+}
+
+func TestDelete(t *testing.T) {
+	tree := New()
+	tree.Insert(mustCIDR(t, "10.0.0.0/8"), "wide")
+	tree.Insert(mustCIDR(t, "10.1.0.0/16"), "narrow")
+
+	if tree.Delete(mustCIDR(t, "10.1.1.0/24")) {
+		t.Fatal("deleted a prefix that was never inserted")
+	}
+	if !tree.Delete(mustCIDR(t, "10.1.0.0/16")) {
+		t.Fatal("failed to delete 10.1.0.0/16")
+	}
+	if got, _ := tree.Lookup(net.ParseIP("10.1.2.3")); got != "wide" {
+		t.Fatalf("got %v after delete, want wide", got)
+	}
+	if !tree.Delete(mustCIDR(t, "10.0.0.0/8")) {
+		t.Fatal("failed to delete 10.0.0.0/8")
+	}
+	if _, ok := tree.Lookup(net.ParseIP("10.1.2.3")); ok || tree.Len() != 0 {
+		t.Fatal("tree should be empty")
+	}
+}
@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+	"net/http"
+	"time"
+)
+
+const namespace = "habridge"
+
+var (
+	// VlanFallbackTotal counts the addresses whose vlan had to be taken from
+	// the IPPool cidr because no IPRecorder entry was found.
+	VlanFallbackTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vlan_fallback_total",
+		Help:      "Number of VMI addresses resolved through IPPool cidr containment instead of an IPRecorder.",
+	})
+
+	LinkEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "link_events_total",
+		Help:      "Number of netlink link events received, by type.",
+	}, []string{"type"})
+
+	TriggersTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failover_triggers_total",
+		Help:      "Number of failover triggers, by source.",
+	}, []string{"source"})
+
+	FramesSentTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frames_sent_total",
+		Help:      "Number of announcement frames written, by bridge, vlan and address family.",
+	}, []string{"bridge", "vlan", "family"})
+
+	FramesFailedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "frames_failed_total",
+		Help:      "Number of announcement frames that could not be written, by bridge, vlan and address family.",
+	}, []string{"bridge", "vlan", "family"})
+
+	AnnouncementsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "announcements_total",
+		Help:      "Number of announcements sent, a burst or a QMP command counting once, by announcer and result.",
+	}, []string{"announcer", "result"})
+
+	// BondActiveSlave is 1 for the current active slave of each bond.
+	BondActiveSlave = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bond_active_slave",
+		Help:      "The active slave of each monitored bond, set to 1.",
+	}, []string{"bond", "slave"})
+
+	RoundDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "failover_round_duration_seconds",
+		Help:      "Time from the failover trigger to the last frame of the round.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	})
+
+	// AddressesRefusedTotal counts the addresses reported by VMIs that IPAM
+	// did not give them.
+	AddressesRefusedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "addresses_refused_total",
+		Help:      "Number of VMI addresses refused for failing the ownership checks, by reason.",
+	}, []string{"reason"})
+
+	AddressConflictsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "address_conflicts_total",
+		Help:      "Number of addresses left out of a round for another mac answering their arp probe, by bridge.",
+	}, []string{"bridge"})
+
+	GatewayChecksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gateway_checks_total",
+		Help:      "Number of gateway checks run after a round, by vlan and result: reachable, unreachable or error.",
+	}, []string{"vlan", "result"})
+
+	GatewayChangesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "gateway_changes_total",
+		Help:      "Number of vrrp master or gateway mac changes seen on the bridges, by bridge and kind: vrrp or arp.",
+	}, []string{"bridge", "kind"})
+
+	VMIsReannouncedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vmis_reannounced_total",
+		Help:      "Number of times a VMI was announced again for receiving no packets after a round.",
+	})
+
+	VMIsUnrecoveredTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vmis_unrecovered_total",
+		Help:      "Number of VMIs that sent no unicast packets after a round and all its re-announcements.",
+	})
+
+	EventsDroppedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_dropped_total",
+		Help:      "Number of Kubernetes events dropped by the event rate limit, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	prometheus.MustRegister(VlanFallbackTotal, LinkEventsTotal, TriggersTotal,
+		FramesSentTotal, FramesFailedTotal, AnnouncementsTotal, BondActiveSlave, RoundDuration, AddressesRefusedTotal, AddressConflictsTotal, GatewayChecksTotal, GatewayChangesTotal,
+		VMIsReannouncedTotal, VMIsUnrecoveredTotal, EventsDroppedTotal)
+}
+
+// RegisterLocalVMIs exports the number of VMIs on this node as counted by f.
+func RegisterLocalVMIs(f func() int) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "local_vmis",
+		Help:      "Number of VMIs running on this node.",
+	}, func() float64 {
+		return float64(f())
+	}))
+}
+
+// RegisterInformerSynced exports whether the informer called name has synced.
+func RegisterInformerSynced(name string, hasSynced func() bool) {
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   namespace,
+		Name:        "informer_synced",
+		Help:        "Whether the informer has synced its cache, 1 for synced.",
+		ConstLabels: prometheus.Labels{"informer": name},
+	}, func() float64 {
+		if hasSynced() {
+			return 1
+		}
+		return 0
+	}))
+}
+
+// Serve exposes the metrics on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+	klog.Infof("serve metrics on %s", addr)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		klog.Errorf("metrics server: %v", err)
+	}
+}
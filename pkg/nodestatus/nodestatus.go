@@ -0,0 +1,167 @@
+package nodestatus
+
+import (
+	"context"
+	"ha-bridge/api/habridge/v1alpha1"
+	habridgev1alpha1 "ha-bridge/generated/habridge/clientset/versioned/typed/habridge/v1alpha1"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/failover"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sync"
+	"time"
+)
+
+// FieldManager owns the fields the agent applies.
+const FieldManager = "habridge"
+
+// maxRoundErrors bounds the errors kept per round so a round failing for
+// every VMI does not bloat the object.
+const maxRoundErrors = 10
+
+// Writer keeps the BridgeNodeStatus named after this node up to date with
+// server-side apply, writing at most once per StatusMinInterval.
+type Writer struct {
+	client habridgev1alpha1.BridgeNodeStatusInterface
+	node   string
+	// dirty holds at most one pending write; changes arriving while one is
+	// pending are folded into it.
+	dirty chan struct{}
+
+	// seeded is set once the rounds of the object already stored have been
+	// read back, so that a restart keeps the history.
+	seeded bool
+
+	mu     sync.Mutex
+	rounds []v1alpha1.FailoverRound
+}
+
+// NewWriter returns a Writer for the BridgeNodeStatus of node.
+func NewWriter(client habridgev1alpha1.BridgeNodeStatusInterface, node string) *Writer {
+	return &Writer{client: client, node: node, dirty: make(chan struct{}, 1)}
+}
+
+// RecordRound adds the round described by report to the history and
+// schedules a write.
+func (w *Writer) RecordRound(report *failover.Report) {
+	round := v1alpha1.FailoverRound{
+		Time:           metav1.NewTime(report.Cause.At),
+		Duration:       metav1.Duration{Duration: report.Duration},
+		Trigger:        report.Cause.Source,
+		Bond:           report.Cause.Bond,
+		OldSlave:       report.Cause.OldSlave,
+		NewSlave:       report.Cause.NewSlave,
+		Vlan:           report.Cause.Vlan,
+		Result:         report.Result(),
+		FramesSent:     report.Sent,
+		FramesFailed:   report.Failed,
+		VMIs:           report.Announced(),
+		Errors:         report.Errors(maxRoundErrors),
+		FromCheckpoint: report.FromCheckpoint,
+		FromDiscovery:  report.FromDiscovery,
+		Announcers:     report.AnnouncerResults(),
+		Gateways:       report.GatewayResults(),
+		Unrecovered:    report.Unrecovered,
+	}
+	w.mu.Lock()
+	w.rounds = append([]v1alpha1.FailoverRound{round}, w.rounds...)
+	if history := config.Get().StatusHistory; len(w.rounds) > history {
+		w.rounds = w.rounds[:history]
+	}
+	w.mu.Unlock()
+	w.markDirty()
+}
+
+func (w *Writer) markDirty() {
+	select {
+	case w.dirty <- struct{}{}:
+	default:
+	}
+}
+
+// Run writes the status whenever a round is recorded and every
+// StatusRefreshPeriod, until ctx is done. The first write keeps the rounds of
+// the object already stored. A failed write is retried after
+// StatusMinInterval.
+func (w *Writer) Run(ctx context.Context) {
+	w.markDirty()
+	for {
+		refresh := time.NewTimer(config.Get().StatusRefreshPeriod.Duration)
+		select {
+		case <-ctx.Done():
+			refresh.Stop()
+			return
+		case <-w.dirty:
+		case <-refresh.C:
+		}
+		refresh.Stop()
+		if err := w.apply(); err != nil {
+			klog.Errorf("apply BridgeNodeStatus %s: %v", w.node, err)
+			w.markDirty()
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.Get().StatusMinInterval.Duration):
+		}
+	}
+}
+
+func (w *Writer) apply() error {
+	if !w.seeded {
+		if err := w.seed(); err != nil {
+			return err
+		}
+		w.seeded = true
+	}
+	status, err := w.status()
+	if err != nil {
+		return err
+	}
+	_, err = w.client.Apply(status, FieldManager, true)
+	return err
+}
+
+// seed appends the rounds of the stored object to those recorded since the
+// start, which are newer.
+func (w *Writer) seed() error {
+	stored, err := w.client.Get(w.node, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.rounds = append(w.rounds, stored.Status.Rounds...)
+	if history := config.Get().StatusHistory; len(w.rounds) > history {
+		w.rounds = w.rounds[:history]
+	}
+	return nil
+}
+
+// status builds the object the agent owns from the node's current state.
+func (w *Writer) status() (*v1alpha1.BridgeNodeStatus, error) {
+	cfg := config.Get()
+	bridges, err := readBridges(cfg.BridgePrefix)
+	if err != nil {
+		return nil, err
+	}
+	status := &v1alpha1.BridgeNodeStatus{
+		TypeMeta:   metav1.TypeMeta{APIVersion: v1alpha1.SchemeGroupVersion.String(), Kind: "BridgeNodeStatus"},
+		ObjectMeta: metav1.ObjectMeta{Name: w.node},
+		Status: v1alpha1.BridgeNodeStatusStatus{
+			Bridges:        bridges,
+			LastUpdateTime: metav1.Now(),
+		},
+	}
+	for _, bond := range cfg.Bonds {
+		status.Status.Bonds = append(status.Status.Bonds, readBond(bond))
+	}
+	w.mu.Lock()
+	status.Status.Rounds = append([]v1alpha1.FailoverRound(nil), w.rounds...)
+	w.mu.Unlock()
+	return status, nil
+}
@@ -0,0 +1,118 @@
+package nodestatus
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/generated/habridge/clientset/versioned"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/failover"
+	"k8s.io/client-go/rest"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"bond0/bonding/mode":         "active-backup 1\n",
+		"bond0/bonding/slaves":       "eth0 eth1\n",
+		"bond0/bonding/active_slave": "eth1\n",
+		"bond0/carrier":              "1\n",
+		"vlan100/bridge/stp_state":   "0\n",
+		"vlan100/brif/bond0.100":     "",
+		"vlan20/bridge/stp_state":    "0\n",
+		"vlanx/bridge/stp_state":     "0\n",
+		"vlan0/bridge/stp_state":     "0\n",
+		"vlan5000/bridge/stp_state":  "0\n",
+	})
+	saved := sysClassNet
+	defer func() { sysClassNet = saved }()
+	sysClassNet = dir
+
+	var got v1alpha1.BridgeNodeStatus
+	var query, contentType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/habridge.cmos.chinamobile.com/v1alpha1/bridgenodestatuses/node-a" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			// the object written before a restart
+			json.NewEncoder(w).Encode(v1alpha1.BridgeNodeStatus{Status: v1alpha1.BridgeNodeStatusStatus{
+				Rounds: []v1alpha1.FailoverRound{{Trigger: "stored"}, {Trigger: "older"}},
+			}})
+			return
+		}
+		if r.Method != http.MethodPatch {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		query, contentType = r.URL.RawQuery, r.Header.Get("Content-Type")
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+	client, err := versioned.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.StatusHistory = 4
+	config.Set(cfg)
+	defer config.Set(config.Default())
+	w := NewWriter(client.HabridgeV1alpha1().BridgeNodeStatuses(), "node-a")
+	for _, trigger := range []string{"first", "second", "third"} {
+		w.RecordRound(&failover.Report{Cause: failover.Cause{Source: trigger, At: time.Now()}})
+	}
+	if err := w.apply(); err != nil {
+		t.Fatal(err)
+	}
+
+	if contentType != "application/apply-patch+yaml" || query != "fieldManager=habridge&force=true" {
+		t.Errorf("not a server-side apply: %s ?%s", contentType, query)
+	}
+	if got.Kind != "BridgeNodeStatus" || got.Name != "node-a" {
+		t.Errorf("unexpected object %s %s", got.Kind, got.Name)
+	}
+	bonds := got.Status.Bonds
+	if len(bonds) != 1 || bonds[0].Mode != "active-backup" || bonds[0].ActiveSlave != "eth1" || len(bonds[0].Slaves) != 2 || !bonds[0].Carrier {
+		t.Errorf("unexpected bonds %+v", bonds)
+	}
+	bridges := got.Status.Bridges
+	if len(bridges) != 2 || bridges[0].Name != "vlan20" || bridges[1].Vlan != 100 || len(bridges[1].LowerDevices) != 1 {
+		t.Errorf("unexpected bridges %+v", bridges)
+	}
+	var triggers []string
+	for _, round := range got.Status.Rounds {
+		triggers = append(triggers, round.Trigger)
+	}
+	if want := []string{"third", "second", "first", "stored"}; !reflect.DeepEqual(triggers, want) {
+		t.Errorf("rounds = %q, want %q", triggers, want)
+	}
+}
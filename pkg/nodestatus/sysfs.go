@@ -0,0 +1,66 @@
+package nodestatus
+
+import (
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/pkg/discovery"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sysClassNet is where the kernel publishes bond and bridge state.
+var sysClassNet = "/sys/class/net"
+
+// readBond reads the state of bond; a bond the driver does not know is
+// reported with only its name.
+func readBond(bond string) v1alpha1.BondStatus {
+	status := v1alpha1.BondStatus{Name: bond}
+	dir := filepath.Join(sysClassNet, bond)
+	// mode reads like "active-backup 1"
+	if fields := strings.Fields(readFile(filepath.Join(dir, "bonding", "mode"))); len(fields) > 0 {
+		status.Mode = fields[0]
+	}
+	status.Slaves = strings.Fields(readFile(filepath.Join(dir, "bonding", "slaves")))
+	status.ActiveSlave = readFile(filepath.Join(dir, "bonding", "active_slave"))
+	status.Carrier = readFile(filepath.Join(dir, "carrier")) == "1"
+	return status
+}
+
+// readBridges lists the bridges named prefix followed by a vlan id, as
+// discovery.BridgeVlan reads them, together with the devices attached to
+// them.
+func readBridges(prefix string) ([]v1alpha1.BridgeStatus, error) {
+	links, err := ioutil.ReadDir(sysClassNet)
+	if err != nil {
+		return nil, err
+	}
+	var result []v1alpha1.BridgeStatus
+	for _, link := range links {
+		name := link.Name()
+		vlan, ok := discovery.BridgeVlan(prefix, name)
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(sysClassNet, name, "bridge")); err != nil {
+			continue
+		}
+		bridge := v1alpha1.BridgeStatus{Name: name, Vlan: vlan}
+		ports, _ := ioutil.ReadDir(filepath.Join(sysClassNet, name, "brif"))
+		for _, port := range ports {
+			bridge.LowerDevices = append(bridge.LowerDevices, port.Name())
+		}
+		result = append(result, bridge)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Vlan < result[j].Vlan })
+	return result, nil
+}
+
+func readFile(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
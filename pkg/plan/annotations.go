@@ -0,0 +1,100 @@
+package plan
+
+import (
+	"fmt"
+	v1 "kubevirt.io/client-go/api/v1"
+	"strconv"
+	"strings"
+)
+
+// The annotations a VMI tunes its announcements with.
+const (
+	// AnnotationAnnounce set to "false" opts the VMI out, for the guests
+	// announcing their addresses themselves, such as VRRP appliances. Set to
+	// "true" it opts the VMI in over an AnnouncePolicy disabling it.
+	AnnotationAnnounce = "habridge.cmos.chinamobile.com/announce"
+	// AnnotationInterfaces restricts the announcements to a comma separated
+	// list of interfaces.
+	AnnotationInterfaces = "habridge.cmos.chinamobile.com/announce-interfaces"
+	// AnnotationPriority orders the VMI in a round, the highest first, over
+	// the priority of its AnnouncePolicy.
+	AnnotationPriority = "habridge.cmos.chinamobile.com/announce-priority"
+	// AnnotationExtraBursts asks for the frames of the VMI to be written in
+	// that many more bursts.
+	AnnotationExtraBursts = "habridge.cmos.chinamobile.com/announce-extra-bursts"
+)
+
+// MaxExtraBursts bounds AnnotationExtraBursts, so a VMI cannot have a round
+// flood its vlan.
+const MaxExtraBursts = 10
+
+// Annotations is what the annotations of a VMI ask for.
+type Annotations struct {
+	// Disabled and Enabled are set when the VMI opts out or in.
+	Disabled bool
+	Enabled  bool
+	// Interfaces, when not empty, are the only interfaces announced.
+	Interfaces []string
+	// Priority is nil when the VMI leaves it to its policy.
+	Priority    *int
+	ExtraBursts int
+}
+
+// ParseAnnotations reads the announcement annotations of vmi. The values it
+// cannot use are left out and reported in the error.
+func ParseAnnotations(vmi *v1.VirtualMachineInstance) (Annotations, error) {
+	var a Annotations
+	var errs []string
+	if value, ok := vmi.Annotations[AnnotationAnnounce]; ok {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %q is not a boolean", AnnotationAnnounce, value))
+		}
+		a.Disabled = err == nil && !enabled
+		a.Enabled = err == nil && enabled
+	}
+	if value := vmi.Annotations[AnnotationInterfaces]; value != "" {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				a.Interfaces = append(a.Interfaces, name)
+			}
+		}
+	}
+	if value, ok := vmi.Annotations[AnnotationPriority]; ok {
+		priority, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %q is not an integer", AnnotationPriority, value))
+		} else {
+			a.Priority = &priority
+		}
+	}
+	if value, ok := vmi.Annotations[AnnotationExtraBursts]; ok {
+		bursts, err := strconv.Atoi(value)
+		switch {
+		case err != nil || bursts < 0:
+			errs = append(errs, fmt.Sprintf("%s: %q is not a positive integer", AnnotationExtraBursts, value))
+		case bursts > MaxExtraBursts:
+			errs = append(errs, fmt.Sprintf("%s: %d is more than %d", AnnotationExtraBursts, bursts, MaxExtraBursts))
+			a.ExtraBursts = MaxExtraBursts
+		default:
+			a.ExtraBursts = bursts
+		}
+	}
+	if len(errs) > 0 {
+		return a, fmt.Errorf("vmi %s/%s: %s", vmi.Namespace, vmi.Name, strings.Join(errs, ", "))
+	}
+	return a, nil
+}
+
+// announces tells whether the annotations leave intf announced.
+func (a Annotations) announces(intf string) bool {
+	if len(a.Interfaces) == 0 {
+		return true
+	}
+	for _, name := range a.Interfaces {
+		if name == intf {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,287 @@
+// Package plan works out what a failover round announces: which VMIs are
+// local to the node and where their addresses are announced, which the
+// announcers turn into frames. It writes nothing, so the agent, its dry-run
+// mode and habridgectl share it.
+package plan
+
+import (
+	"fmt"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/ipam"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+	v1 "kubevirt.io/client-go/api/v1"
+	"time"
+)
+
+// Reasons a VMI or one of its interfaces is skipped.
+const (
+	// ReasonNotLocal: the VMI has migrated to another node.
+	ReasonNotLocal = "NotLocal"
+	// ReasonInterfaceNotAnnounced: the configuration leaves the interface out.
+	ReasonInterfaceNotAnnounced = "InterfaceNotAnnounced"
+	// ReasonNoIPAddress: the guest reports no address on the interface.
+	ReasonNoIPAddress = "NoIPAddress"
+	// ReasonIPAMLookupFailed: neither IPRecorder nor IPPool hold the address.
+	ReasonIPAMLookupFailed = "IPAMLookupFailed"
+	// ReasonUnsupportedFamily: the address is not IPv4.
+	ReasonUnsupportedFamily = "UnsupportedFamily"
+	// ReasonInvalidAddress: the address or the mac cannot be parsed.
+	ReasonInvalidAddress = "InvalidAddress"
+	// ReasonNoUplink: no bond is enslaved to the bridge to write tagged
+	// frames on.
+	ReasonNoUplink = "NoUplink"
+	// ReasonUnknownAnnouncer: the policy names an announcer this build lacks.
+	ReasonUnknownAnnouncer = "UnknownAnnouncer"
+	// ReasonDisabled: an AnnouncePolicy or the VMI turns the announcements
+	// off.
+	ReasonDisabled = "Disabled"
+	// ReasonAddressNotRecorded: no IPRecorder entry holds the address the VMI
+	// reports.
+	ReasonAddressNotRecorded = "AddressNotRecorded"
+	// ReasonAddressOwnerMismatch: IPAM gave the address to another VMI.
+	ReasonAddressOwnerMismatch = "AddressOwnerMismatch"
+	// ReasonAddressOutsidePool: the address is not in the cidr of its
+	// IPPool.
+	ReasonAddressOutsidePool = "AddressOutsidePool"
+	// ReasonAddressConflict: another mac answers the arp probe of the
+	// address.
+	ReasonAddressConflict = "AddressConflict"
+)
+
+// refusals maps the ownership checks of ipam to the reasons of their skips.
+var refusals = map[string]string{
+	ipam.CheckRecorded: ReasonAddressNotRecorded,
+	ipam.CheckOwner:    ReasonAddressOwnerMismatch,
+	ipam.CheckPool:     ReasonAddressOutsidePool,
+}
+
+// Frame is a frame a round writes on a host link, or another announcement
+// such as a command to QEMU.
+type Frame struct {
+	Namespace string `json:"namespace"`
+	VMI       string `json:"vmi"`
+	// Interface is empty for the announcements of the whole VMI.
+	Interface string `json:"interface"`
+	Bridge    string `json:"bridge"`
+	Vlan      int    `json:"vlan"`
+	// Kind is the announcer that planned the frame.
+	Kind string `json:"kind"`
+	// Link is where the frame is written when not on Bridge.
+	Link string `json:"link,omitempty"`
+	IP   string `json:"ip"`
+	MAC  string `json:"mac"`
+	Data []byte `json:"data"`
+	// Count is how many times the frame is written, once when 0.
+	Count int `json:"count,omitempty"`
+	// Interval is the time between the writes of the frame, RARPInterval
+	// when 0.
+	Interval time.Duration `json:"interval,omitempty"`
+	// Priority orders the frames of a round, the highest first.
+	Priority int `json:"priority,omitempty"`
+	// Policy is the AnnouncePolicy the frame was planned under, if any.
+	Policy string `json:"policy,omitempty"`
+	// Gateway is the gateway of the vlan the frame announces IP on.
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// Skip is a VMI, or one interface or address of it, that a round does not
+// announce.
+type Skip struct {
+	Namespace string `json:"namespace"`
+	VMI       string `json:"vmi"`
+	Interface string `json:"interface,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	Reason    string `json:"reason"`
+	Message   string `json:"message"`
+}
+
+// Expected tells whether the skip follows from the configuration rather than
+// from something being wrong.
+func (s Skip) Expected() bool {
+	switch s.Reason {
+	case ReasonNotLocal, ReasonInterfaceNotAnnounced, ReasonUnsupportedFamily, ReasonDisabled:
+		return true
+	}
+	return false
+}
+
+// Refused tells whether the skip is an address the VMI does not own.
+func (s Skip) Refused() bool {
+	switch s.Reason {
+	case ReasonAddressNotRecorded, ReasonAddressOwnerMismatch, ReasonAddressOutsidePool:
+		return true
+	}
+	return false
+}
+
+// Plan is what a round announces.
+type Plan struct {
+	Frames  []Frame `json:"frames"`
+	Skipped []Skip  `json:"skipped"`
+}
+
+// Select returns the VMIs of vmis running on node, each once, and the skips
+// of those that have left it.
+func Select(vmis []v1.VirtualMachineInstance, node string) ([]v1.VirtualMachineInstance, []Skip) {
+	var result []v1.VirtualMachineInstance
+	var skipped []Skip
+	seen := map[types.UID]bool{}
+	for i := range vmis {
+		vmi := &vmis[i]
+		if seen[vmi.UID] {
+			continue
+		}
+		seen[vmi.UID] = true
+		if !IsLocal(vmi, node) {
+			skipped = append(skipped, Skip{Namespace: vmi.Namespace, VMI: vmi.Name, Reason: ReasonNotLocal,
+				Message: fmt.Sprintf("vmi runs on %s", vmi.Status.NodeName)})
+			continue
+		}
+		result = append(result, *vmi)
+	}
+	return result, skipped
+}
+
+// IsLocal reports whether vmi is running on node. The node label and
+// status.nodeName only move after a migration has been handed over, so a
+// completed migration decides on its own which side owns the VMI.
+func IsLocal(vmi *v1.VirtualMachineInstance, node string) bool {
+	if state := vmi.Status.MigrationState; state != nil && state.Completed && !state.Failed {
+		if state.TargetNode == node {
+			return true
+		}
+		if state.SourceNode == node {
+			return false
+		}
+	}
+	return vmi.Status.NodeName == node
+}
+
+// Target is a VMI interface resolved to the host bridge its addresses are
+// announced on.
+type Target struct {
+	Namespace string   `json:"namespace"`
+	VMI       string   `json:"vmi"`
+	Interface string   `json:"interface"`
+	MAC       string   `json:"mac"`
+	IPs       []string `json:"ips"`
+	Vlan      int      `json:"vlan"`
+	Bridge    string   `json:"bridge"`
+	// Pool is the IPPool of the addresses, unknown for the interfaces placed
+	// by their mac.
+	Pool string `json:"pool,omitempty"`
+	// Gateway is the gateway IPAM gives the addresses.
+	Gateway string `json:"gateway,omitempty"`
+	// Enabled, Priority and ExtraBursts are what the annotations of the VMI
+	// ask for.
+	Enabled     bool `json:"enabled,omitempty"`
+	Priority    *int `json:"priority,omitempty"`
+	ExtraBursts int  `json:"extraBursts,omitempty"`
+}
+
+// BridgeLookup finds the bridge a mac address sits behind, and its vlan.
+type BridgeLookup func(mac string) (bridge string, vlan int, ok bool)
+
+// Resolve looks up the bridge of every interface of vmi announced under cfg
+// and the annotations of vmi. IPAM places the interfaces with an ip address,
+// leaving out the addresses it did not give to vmi when cfg verifies
+// ownership. Those without one are only announced by their mac, on the
+// bridge lookup finds it behind.
+func Resolve(cfg *config.Config, vmi *v1.VirtualMachineInstance, lookup BridgeLookup) ([]Target, []Skip) {
+	var targets []Target
+	var skipped []Skip
+	skip := func(intf, ip, reason, format string, args ...interface{}) {
+		skipped = append(skipped, Skip{Namespace: vmi.Namespace, VMI: vmi.Name, Interface: intf, IP: ip,
+			Reason: reason, Message: fmt.Sprintf(format, args...)})
+	}
+	annotations, err := ParseAnnotations(vmi)
+	if err != nil {
+		klog.Warningf("ignore invalid annotations: %v", err)
+	}
+	if annotations.Disabled {
+		skip("", "", ReasonDisabled, "vmi %s/%s opts out with annotation %s", vmi.Namespace, vmi.Name, AnnotationAnnounce)
+		return nil, skipped
+	}
+	for _, intf := range vmi.Status.Interfaces {
+		if !cfg.AnnounceInterface(intf.InterfaceName) {
+			skip(intf.InterfaceName, "", ReasonInterfaceNotAnnounced, "interface %q is not announced", intf.InterfaceName)
+			continue
+		}
+		if !annotations.announces(intf.InterfaceName) {
+			skip(intf.InterfaceName, "", ReasonInterfaceNotAnnounced, "interface %q is not in annotation %s", intf.InterfaceName, AnnotationInterfaces)
+			continue
+		}
+		if intf.IP == "" {
+			if lookup == nil {
+				skip(intf.InterfaceName, "", ReasonNoIPAddress, "interface %q has no ip address", intf.InterfaceName)
+				continue
+			}
+			bridge, vlan, ok := lookup(intf.MAC)
+			if !ok {
+				skip(intf.InterfaceName, "", ReasonNoIPAddress, "interface %q has no ip address and its mac %s is not in the bridge fdb", intf.InterfaceName, intf.MAC)
+				continue
+			}
+			targets = append(targets, Target{
+				Namespace:   vmi.Namespace,
+				VMI:         vmi.Name,
+				Interface:   intf.InterfaceName,
+				MAC:         intf.MAC,
+				Vlan:        vlan,
+				Bridge:      bridge,
+				Enabled:     annotations.Enabled,
+				Priority:    annotations.Priority,
+				ExtraBursts: annotations.ExtraBursts,
+			})
+			continue
+		}
+		refuse := func(ip string) bool {
+			if !cfg.VerifyOwnership {
+				return false
+			}
+			err := ipam.VerifyOwner(ip, vmi)
+			if oerr, ok := err.(*ipam.OwnershipError); ok {
+				skip(intf.InterfaceName, ip, refusals[oerr.Check], "refuse to announce: %v", err)
+				return true
+			}
+			return false
+		}
+		// the vlan of an address the VMI does not own is no better, so
+		// nothing of the interface is announced
+		if refuse(intf.IP) {
+			continue
+		}
+		entry, bridge, err := ipam.CheckInterface(cfg, intf)
+		if err != nil {
+			skip(intf.InterfaceName, intf.IP, ReasonIPAMLookupFailed, "%v", err)
+			continue
+		}
+		var ips []string
+		for _, ip := range intf.IPs {
+			if ip == intf.IP || !refuse(ip) {
+				ips = append(ips, ip)
+			}
+		}
+		targets = append(targets, Target{
+			Namespace:   vmi.Namespace,
+			VMI:         vmi.Name,
+			Interface:   intf.InterfaceName,
+			MAC:         intf.MAC,
+			IPs:         ips,
+			Vlan:        entry.Vlan,
+			Bridge:      bridge,
+			Pool:        entry.Pool,
+			Gateway:     entry.Gateway,
+			Enabled:     annotations.Enabled,
+			Priority:    annotations.Priority,
+			ExtraBursts: annotations.ExtraBursts,
+		})
+	}
+	return targets, skipped
+}
+
+// Add appends the frames and skips of other to p.
+func (p *Plan) Add(other *Plan) {
+	p.Frames = append(p.Frames, other.Frames...)
+	p.Skipped = append(p.Skipped, other.Skipped...)
+}
@@ -0,0 +1,176 @@
+package plan
+
+import (
+	"testing"
+
+	v2 "cmos.chinamobile.com/ip-fixed/api/ipfixed/v1alpha1"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/ipam"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	v1 "kubevirt.io/client-go/api/v1"
+)
+
+func TestIsLocal(t *testing.T) {
+	cases := []struct {
+		name  string
+		node  string
+		state *v1.VirtualMachineInstanceMigrationState
+		local bool
+	}{
+		{"running here", "node-a", nil, true},
+		{"running elsewhere", "node-b", nil, false},
+		{"migrating away", "node-a", &v1.VirtualMachineInstanceMigrationState{SourceNode: "node-a", TargetNode: "node-b"}, true},
+		{"migrated away", "node-a", &v1.VirtualMachineInstanceMigrationState{SourceNode: "node-a", TargetNode: "node-b", Completed: true}, false},
+		{"migrated here", "node-b", &v1.VirtualMachineInstanceMigrationState{SourceNode: "node-b", TargetNode: "node-a", Completed: true}, true},
+		{"failed migration here", "node-b", &v1.VirtualMachineInstanceMigrationState{SourceNode: "node-b", TargetNode: "node-a", Completed: true, Failed: true}, false},
+	}
+	for _, c := range cases {
+		vmi := &v1.VirtualMachineInstance{}
+		vmi.Status.NodeName = c.node
+		vmi.Status.MigrationState = c.state
+		if got := IsLocal(vmi, "node-a"); got != c.local {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.local)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	vmis := make([]v1.VirtualMachineInstance, 3)
+	for i, node := range []string{"node-a", "node-b", "node-a"} {
+		vmis[i].Name, vmis[i].Status.NodeName = node, node
+		vmis[i].UID = types.UID(node)
+	}
+	selected, skipped := Select(vmis, "node-a")
+	if len(selected) != 1 || selected[0].Name != "node-a" {
+		t.Errorf("unexpected selection %+v", selected)
+	}
+	if len(skipped) != 1 || skipped[0].Reason != ReasonNotLocal || !skipped[0].Expected() {
+		t.Errorf("unexpected skips %+v", skipped)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	informer.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: "r"}, IPLists: []v2.IPRecorderIPLists{{IPAddress: "10.0.0.2", Vlan: 100}}})
+	ipam.RecorderInformer = informer
+
+	vmi := &v1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name = "default", "vm1"
+	vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:01", IP: "10.0.0.2", IPs: []string{"10.0.0.2"}},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:02"},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:03"},
+	}
+	lookup := func(mac string) (string, int, bool) {
+		return "vlan200", 200, mac == "02:00:00:00:00:02"
+	}
+	cfg := config.Default()
+	cfg.VerifyOwnership = false
+	targets, skipped := Resolve(cfg, vmi, lookup)
+	if len(targets) != 2 || targets[0].Bridge != "vlan100" || targets[1].Bridge != "vlan200" || targets[1].Vlan != 200 || len(targets[1].IPs) != 0 {
+		t.Errorf("unexpected targets %+v", targets)
+	}
+	if len(skipped) != 1 || skipped[0].Reason != ReasonNoIPAddress {
+		t.Errorf("unexpected skips %+v", skipped)
+	}
+
+	targets, skipped = Resolve(cfg, vmi, nil)
+	if len(targets) != 1 || len(skipped) != 2 {
+		t.Errorf("without lookup the interfaces without ip should be skipped: %+v %+v", targets, skipped)
+	}
+}
+
+func TestResolveAnnotations(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	informer.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: "r"}, IPLists: []v2.IPRecorderIPLists{
+		{IPAddress: "10.0.0.2", Vlan: 100, Pool: "pool-a"}, {IPAddress: "10.0.1.2", Vlan: 101, Pool: "pool-b"}}})
+	ipam.RecorderInformer = informer
+
+	vmi := &v1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name = "default", "db"
+	vmi.Annotations = map[string]string{
+		AnnotationInterfaces:  "eth1",
+		AnnotationPriority:    "100",
+		AnnotationExtraBursts: "50",
+	}
+	vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:01", IP: "10.0.0.2", IPs: []string{"10.0.0.2"}},
+		{InterfaceName: "eth1", MAC: "02:00:00:00:00:02", IP: "10.0.1.2", IPs: []string{"10.0.1.2"}},
+	}
+	cfg := config.Default()
+	cfg.Interfaces, cfg.VerifyOwnership = nil, false
+	targets, skipped := Resolve(cfg, vmi, nil)
+	if len(targets) != 1 || targets[0].Interface != "eth1" || targets[0].Pool != "pool-b" ||
+		targets[0].Priority == nil || *targets[0].Priority != 100 || targets[0].ExtraBursts != MaxExtraBursts {
+		t.Errorf("unexpected targets %+v", targets)
+	}
+	if len(skipped) != 1 || skipped[0].Interface != "eth0" || skipped[0].Reason != ReasonInterfaceNotAnnounced {
+		t.Errorf("unexpected skips %+v", skipped)
+	}
+
+	vmi.Annotations = map[string]string{AnnotationAnnounce: "false"}
+	targets, skipped = Resolve(cfg, vmi, nil)
+	if len(targets) != 0 || len(skipped) != 1 || skipped[0].Reason != ReasonDisabled || !skipped[0].Expected() {
+		t.Errorf("an opted out vmi should be skipped as a whole: %+v %+v", targets, skipped)
+	}
+	vmi.Annotations = map[string]string{AnnotationAnnounce: "true"}
+	if targets, _ = Resolve(cfg, vmi, nil); len(targets) != 2 || !targets[0].Enabled || !targets[1].Enabled {
+		t.Errorf("the targets of an opted in vmi should say so: %+v", targets)
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	vmi := &v1.VirtualMachineInstance{}
+	vmi.Annotations = map[string]string{
+		AnnotationAnnounce:    "maybe",
+		AnnotationInterfaces:  " eth0, ,eth2 ",
+		AnnotationPriority:    "high",
+		AnnotationExtraBursts: "-1",
+	}
+	a, err := ParseAnnotations(vmi)
+	if err == nil {
+		t.Error("invalid values should be reported")
+	}
+	if a.Disabled || a.Enabled || a.Priority != nil || a.ExtraBursts != 0 || len(a.Interfaces) != 2 || a.Interfaces[1] != "eth2" {
+		t.Errorf("invalid values should be left out: %+v", a)
+	}
+}
+
+func TestResolveVerifiesOwnership(t *testing.T) {
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{}, &v2.IPRecorder{}, 0, cache.Indexers{ipam.IPAddressIndex: ipam.IPAddressIndexFunc})
+	informer.GetIndexer().Add(&v2.IPRecorder{ObjectMeta: metav1.ObjectMeta{Name: "r"}, IPLists: []v2.IPRecorderIPLists{
+		{IPAddress: "10.0.0.2", Vlan: 100, Pool: "pool-a", Namespace: "default", Name: "vm1"},
+		{IPAddress: "10.0.0.3", Vlan: 100, Pool: "pool-a", Namespace: "default", Name: "vm2"},
+		{IPAddress: "10.0.0.4", Vlan: 100, Pool: "pool-a", Namespace: "default", Name: "vm2"},
+		{IPAddress: "10.0.0.5", Vlan: 100, Pool: "pool-a", Resources: "pods", Namespace: "default", Name: "virt-launcher-vm1-abcde"},
+	}})
+	pods := cache.NewSharedIndexInformer(&cache.ListWatch{}, &k8sv1.Pod{}, 0, cache.Indexers{})
+	pods.GetStore().Add(&k8sv1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "virt-launcher-vm1-abcde",
+		Labels: map[string]string{v1.CreatedByLabel: "uid-vm1"}}})
+	savedRecorders, savedPods := ipam.RecorderInformer, ipam.PodInformer
+	defer func() { ipam.RecorderInformer, ipam.PodInformer = savedRecorders, savedPods }()
+	ipam.RecorderInformer, ipam.PodInformer = informer, pods
+	pool := &v2.IPPool{ObjectMeta: metav1.ObjectMeta{Name: "pool-a"}, Spec: v2.IPPoolSpec{Cidr: "10.0.0.0/24", Vlan: 100}}
+	ipam.PoolEventHandler.OnAdd(pool)
+	defer ipam.PoolEventHandler.OnDelete(pool)
+
+	vmi := &v1.VirtualMachineInstance{}
+	vmi.Namespace, vmi.Name, vmi.UID = "default", "vm1", "uid-vm1"
+	vmi.Status.Interfaces = []v1.VirtualMachineInstanceNetworkInterface{
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:01", IP: "10.0.0.2", IPs: []string{"10.0.0.2", "10.0.0.3"}},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:02", IP: "10.0.0.4", IPs: []string{"10.0.0.4"}},
+		{InterfaceName: "eth0", MAC: "02:00:00:00:00:03", IP: "10.0.0.5", IPs: []string{"10.0.0.5"}},
+	}
+	targets, skipped := Resolve(config.Default(), vmi, nil)
+	if len(targets) != 2 || len(targets[0].IPs) != 1 || targets[0].IPs[0] != "10.0.0.2" ||
+		len(targets[1].IPs) != 1 || targets[1].IPs[0] != "10.0.0.5" {
+		t.Errorf("only the addresses of vm1 and its pod should be announced: %+v", targets)
+	}
+	if len(skipped) != 2 || skipped[0].IP != "10.0.0.3" || skipped[1].IP != "10.0.0.4" ||
+		!skipped[0].Refused() || skipped[0].Reason != ReasonAddressOwnerMismatch || skipped[0].Expected() {
+		t.Errorf("the addresses of vm2 should be refused: %+v", skipped)
+	}
+}
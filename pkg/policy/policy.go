@@ -0,0 +1,174 @@
+// Package policy picks the AnnouncePolicy that applies to a VMI interface
+// and what it changes to the way the interface is announced.
+package policy
+
+import (
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/plan"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"sort"
+	"time"
+)
+
+// PolicyInformer watches the AnnouncePolicies, NamespaceInformer the
+// namespaces their namespace selectors match. Without them the configuration
+// alone decides.
+var PolicyInformer cache.SharedIndexInformer
+var NamespaceInformer cache.SharedIndexInformer
+
+// Settings is how an interface is announced.
+type Settings struct {
+	// Policy is the AnnouncePolicy that applies, empty when none does.
+	Policy string
+	// Disabled interfaces are not announced.
+	Disabled bool
+	// Announcers announce the interface, in order.
+	Announcers []string
+	// Burst, when not 0, is how many times each frame is written.
+	Burst int
+	// Interval, when not 0, is the time between the writes of a burst.
+	Interval time.Duration
+	// Priority orders the interfaces of a round, the highest first.
+	Priority int
+}
+
+// For returns the settings of t: those of the most specific AnnouncePolicy
+// selecting it, over the announcers of cfg.
+func For(cfg *config.Config, t plan.Target) Settings {
+	s := Settings{Announcers: cfg.AnnouncersFor(t.Vlan, t.Namespace)}
+	p := Select(list(), t, namespaceLabels(t.Namespace))
+	if p == nil {
+		return s
+	}
+	s.Policy = p.Name
+	s.Disabled = p.Spec.Enabled != nil && !*p.Spec.Enabled
+	if len(p.Spec.Announcers) > 0 {
+		s.Announcers = p.Spec.Announcers
+	}
+	s.Burst = p.Spec.Burst
+	if p.Spec.Interval != nil {
+		s.Interval = p.Spec.Interval.Duration
+	}
+	s.Priority = p.Spec.Priority
+	return s
+}
+
+// Select returns the most specific of policies selecting t, whose namespace
+// has labels nsLabels, or nil. Selecting by IPPool is more specific than by
+// vlan, which is more specific than by namespace; a policy using more of
+// them is more specific still. Ties go to the narrower vlan range, then to
+// the first name.
+func Select(policies []*v1alpha1.AnnouncePolicy, t plan.Target, nsLabels labels.Set) *v1alpha1.AnnouncePolicy {
+	var matched []*v1alpha1.AnnouncePolicy
+	for _, p := range policies {
+		if Matches(p, t, nsLabels) {
+			matched = append(matched, p)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if sa, sb := specificity(a), specificity(b); sa != sb {
+			return sa > sb
+		}
+		if wa, wb := vlanWidth(a), vlanWidth(b); wa != wb {
+			return wa < wb
+		}
+		return a.Name < b.Name
+	})
+	return matched[0]
+}
+
+// Matches tells whether p selects t, whose namespace has labels nsLabels.
+func Matches(p *v1alpha1.AnnouncePolicy, t plan.Target, nsLabels labels.Set) bool {
+	if r := p.Spec.Vlans; r != nil && (t.Vlan < r.From || t.Vlan > r.To) {
+		return false
+	}
+	if len(p.Spec.IPPools) > 0 {
+		found := false
+		for _, pool := range p.Spec.IPPools {
+			if t.Pool != "" && pool == t.Pool {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if p.Spec.NamespaceSelector != nil {
+		if nsLabels == nil {
+			return false
+		}
+		selector, err := metav1.LabelSelectorAsSelector(p.Spec.NamespaceSelector)
+		if err != nil {
+			klog.Warningf("announcepolicy %s: invalid namespace selector: %v", p.Name, err)
+			return false
+		}
+		if !selector.Matches(nsLabels) {
+			return false
+		}
+	}
+	return true
+}
+
+func specificity(p *v1alpha1.AnnouncePolicy) int {
+	score := 0
+	if len(p.Spec.IPPools) > 0 {
+		score += 4
+	}
+	if p.Spec.Vlans != nil {
+		score += 2
+	}
+	if p.Spec.NamespaceSelector != nil {
+		score++
+	}
+	return score
+}
+
+// vlanWidth is the number of vlans p selects, all of them without a range.
+func vlanWidth(p *v1alpha1.AnnouncePolicy) int {
+	if r := p.Spec.Vlans; r != nil {
+		return r.To - r.From + 1
+	}
+	return 4096
+}
+
+func list() []*v1alpha1.AnnouncePolicy {
+	if PolicyInformer == nil {
+		return nil
+	}
+	var policies []*v1alpha1.AnnouncePolicy
+	for _, obj := range PolicyInformer.GetStore().List() {
+		if p, ok := obj.(*v1alpha1.AnnouncePolicy); ok {
+			policies = append(policies, p)
+		}
+	}
+	return policies
+}
+
+// namespaceLabels returns the labels of namespace, nil when it is unknown.
+func namespaceLabels(namespace string) labels.Set {
+	if NamespaceInformer == nil || namespace == "" {
+		return nil
+	}
+	obj, exists, err := NamespaceInformer.GetStore().GetByKey(namespace)
+	if err != nil || !exists {
+		return nil
+	}
+	ns, ok := obj.(*k8sv1.Namespace)
+	if !ok {
+		return nil
+	}
+	if ns.Labels == nil {
+		return labels.Set{}
+	}
+	return labels.Set(ns.Labels)
+}
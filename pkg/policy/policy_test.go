@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"ha-bridge/api/habridge/v1alpha1"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/plan"
+	k8sv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newPolicy(name string, spec v1alpha1.AnnouncePolicySpec) *v1alpha1.AnnouncePolicy {
+	return &v1alpha1.AnnouncePolicy{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: spec}
+}
+
+func TestSelect(t *testing.T) {
+	prod := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+	policies := []*v1alpha1.AnnouncePolicy{
+		newPolicy("default", v1alpha1.AnnouncePolicySpec{}),
+		newPolicy("prod", v1alpha1.AnnouncePolicySpec{NamespaceSelector: prod}),
+		newPolicy("vlans-wide", v1alpha1.AnnouncePolicySpec{Vlans: &v1alpha1.VlanRange{From: 100, To: 199}}),
+		newPolicy("vlans-narrow", v1alpha1.AnnouncePolicySpec{Vlans: &v1alpha1.VlanRange{From: 100, To: 109}}),
+		newPolicy("vlans-prod", v1alpha1.AnnouncePolicySpec{Vlans: &v1alpha1.VlanRange{From: 100, To: 199}, NamespaceSelector: prod}),
+		newPolicy("pool", v1alpha1.AnnouncePolicySpec{IPPools: []string{"pool-a"}}),
+	}
+	tests := []struct {
+		name   string
+		target plan.Target
+		labels labels.Set
+		want   string
+	}{
+		{"pool wins", plan.Target{Vlan: 105, Pool: "pool-a"}, labels.Set{"env": "prod"}, "pool"},
+		{"vlan and namespace", plan.Target{Vlan: 105, Pool: "pool-b"}, labels.Set{"env": "prod"}, "vlans-prod"},
+		{"narrower range", plan.Target{Vlan: 105}, labels.Set{}, "vlans-narrow"},
+		{"wide range", plan.Target{Vlan: 150}, nil, "vlans-wide"},
+		{"namespace", plan.Target{Vlan: 300}, labels.Set{"env": "prod"}, "prod"},
+		{"catch all", plan.Target{Vlan: 300}, nil, "default"},
+	}
+	for _, tt := range tests {
+		got := Select(policies, tt.target, tt.labels)
+		if got == nil || got.Name != tt.want {
+			t.Errorf("%s: got %v, want %s", tt.name, got, tt.want)
+		}
+	}
+	if got := Select(policies[1:3], plan.Target{Vlan: 300}, nil); got != nil {
+		t.Errorf("no policy should select vlan 300 outside prod, got %s", got.Name)
+	}
+}
+
+func TestFor(t *testing.T) {
+	savedPolicies, savedNamespaces := PolicyInformer, NamespaceInformer
+	defer func() { PolicyInformer, NamespaceInformer = savedPolicies, savedNamespaces }()
+	PolicyInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &v1alpha1.AnnouncePolicy{}, 0, cache.Indexers{})
+	NamespaceInformer = cache.NewSharedIndexInformer(&cache.ListWatch{}, &k8sv1.Namespace{}, 0, cache.Indexers{})
+	disabled := false
+	PolicyInformer.GetStore().Add(newPolicy("quiet", v1alpha1.AnnouncePolicySpec{
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"announce": "off"}},
+		Enabled:           &disabled,
+	}))
+	PolicyInformer.GetStore().Add(newPolicy("storage", v1alpha1.AnnouncePolicySpec{
+		Vlans:      &v1alpha1.VlanRange{From: 200, To: 200},
+		Announcers: []string{config.AnnouncerGarpReply},
+		Burst:      3,
+		Interval:   &metav1.Duration{Duration: 20 * time.Millisecond},
+		Priority:   10,
+	}))
+	NamespaceInformer.GetStore().Add(&k8sv1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "lab", Labels: map[string]string{"announce": "off"}}})
+
+	cfg := config.Default()
+	if s := For(cfg, plan.Target{Namespace: "default", Vlan: 100}); s.Policy != "" || len(s.Announcers) != len(cfg.Announcers) {
+		t.Errorf("without a policy the configuration should decide: %+v", s)
+	}
+	if s := For(cfg, plan.Target{Namespace: "lab", Vlan: 100}); s.Policy != "quiet" || !s.Disabled {
+		t.Errorf("the namespace of lab should be disabled: %+v", s)
+	}
+	s := For(cfg, plan.Target{Namespace: "default", Vlan: 200})
+	if s.Policy != "storage" || s.Disabled || len(s.Announcers) != 1 || s.Burst != 3 || s.Interval != 20*time.Millisecond || s.Priority != 10 {
+		t.Errorf("unexpected settings for vlan 200: %+v", s)
+	}
+}
@@ -0,0 +1,183 @@
+// Package qmp speaks just enough of the QEMU Machine Protocol to have QEMU
+// announce a guest itself: announce-self makes QEMU send the rarp frames of
+// every guest nic from inside the VM, which the frames the agent writes on
+// the bridges cannot replace for the state kept by the guest's peers.
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// dialTimeout bounds a whole exchange when the context has no deadline.
+const dialTimeout = 5 * time.Second
+
+// initialDelay is the delay QEMU waits before the first round of
+// announce-self, its own default.
+const initialDelay = 50 * time.Millisecond
+
+// Error is an error returned by QEMU for a command.
+type Error struct {
+	Class string `json:"class"`
+	Desc  string `json:"desc"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Class, e.Desc)
+}
+
+// response is a message from the monitor: the greeting, an event or the
+// answer to a command.
+type response struct {
+	QMP    json.RawMessage `json:"QMP"`
+	Event  string          `json:"event"`
+	Return json.RawMessage `json:"return"`
+	Error  *Error          `json:"error"`
+}
+
+// Client is a connection to a QMP monitor, in command mode.
+type Client struct {
+	conn    net.Conn
+	decoder *json.Decoder
+}
+
+// Dial connects to the QMP socket at path and leaves capabilities
+// negotiation. The connection gives up when ctx is done.
+func Dial(ctx context.Context, path string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dialTimeout)
+	}
+	conn.SetDeadline(deadline)
+	c := &Client{conn: conn, decoder: json.NewDecoder(bufio.NewReader(conn))}
+	var greeting response
+	if err := c.decoder.Decode(&greeting); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("read greeting: %v", err)
+	}
+	if greeting.QMP == nil {
+		conn.Close()
+		return nil, fmt.Errorf("%s is not a qmp monitor", path)
+	}
+	if _, err := c.Execute("qmp_capabilities", nil); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("qmp_capabilities: %v", err)
+	}
+	return c, nil
+}
+
+// Execute runs command with arguments, which may be nil, and returns what
+// it returned. The events sent meanwhile are dropped.
+func (c *Client) Execute(command string, arguments interface{}) (json.RawMessage, error) {
+	req := struct {
+		Execute   string      `json:"execute"`
+		Arguments interface{} `json:"arguments,omitempty"`
+	}{command, arguments}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	for {
+		var resp response
+		if err := c.decoder.Decode(&resp); err != nil {
+			return nil, err
+		}
+		switch {
+		case resp.Error != nil:
+			return nil, resp.Error
+		case resp.Return != nil:
+			return resp.Return, nil
+		}
+	}
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Announce sets how QEMU spaces the rounds of announce-self.
+type Announce struct {
+	// Rounds is the number of rounds.
+	Rounds int
+	// Step is how much longer each round waits than the one before.
+	Step time.Duration
+}
+
+// arguments returns the AnnounceParameters of QEMU, in milliseconds.
+func (a Announce) arguments() interface{} {
+	initial := initialDelay.Milliseconds()
+	step := a.Step.Milliseconds()
+	return map[string]int64{
+		"initial": initial,
+		"max":     initial + int64(a.Rounds)*step,
+		"rounds":  int64(a.Rounds),
+		"step":    step,
+	}
+}
+
+// AnnounceSelf has QEMU announce every nic of the guest as a.
+func (c *Client) AnnounceSelf(a Announce) error {
+	_, err := c.Execute("announce-self", a.arguments())
+	return err
+}
+
+// Socket returns the QMP socket of the VMI namespace/name, found by pattern
+// where {namespace} and {name} stand for them and the rest may hold glob
+// wildcards. When several sockets match, as while a migration within the node
+// runs, the most recent one is the VMI's.
+func Socket(pattern, namespace, name string) (string, error) {
+	glob := strings.NewReplacer("{namespace}", namespace, "{name}", name).Replace(pattern)
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return "", err
+	}
+	var found string
+	var newest time.Time
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.Mode()&os.ModeSocket == 0 {
+			continue
+		}
+		if found == "" || info.ModTime().After(newest) {
+			found, newest = path, info.ModTime()
+		}
+	}
+	if found == "" {
+		return "", fmt.Errorf("no qmp socket matches %s", glob)
+	}
+	return found, nil
+}
+
+// AnnounceVMI has the QEMU of the VMI namespace/name, whose socket pattern
+// finds, announce the guest as a.
+func AnnounceVMI(ctx context.Context, pattern, namespace, name string, a Announce) error {
+	path, err := Socket(pattern, namespace, name)
+	if err != nil {
+		return err
+	}
+	c, err := Dial(ctx, path)
+	if err != nil {
+		return fmt.Errorf("connect %s: %v", path, err)
+	}
+	defer c.Close()
+	if err := c.AnnounceSelf(a); err != nil {
+		return fmt.Errorf("announce-self on %s: %v", path, err)
+	}
+	return nil
+}
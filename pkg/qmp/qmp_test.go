@@ -0,0 +1,139 @@
+package qmp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// command is a command received by the fake QEMU.
+type command struct {
+	Execute   string           `json:"execute"`
+	Arguments map[string]int64 `json:"arguments"`
+}
+
+// fakeQEMU serves a QMP monitor on path, answering every command but the
+// ones in fail with an empty return, after an event. It sends the commands
+// it receives on the returned channel.
+func fakeQEMU(t *testing.T, path string, fail map[string]bool) <-chan command {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commands := make(chan command, 10)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprintln(conn, `{"QMP": {"version": {"qemu": {"micro": 0, "minor": 2, "major": 5}}, "capabilities": []}}`)
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			var cmd command
+			if err := json.Unmarshal(scanner.Bytes(), &cmd); err != nil {
+				fmt.Fprintln(conn, `{"error": {"class": "GenericError", "desc": "JSON parse error"}}`)
+				continue
+			}
+			commands <- cmd
+			fmt.Fprintln(conn, `{"timestamp": {"seconds": 1, "microseconds": 0}, "event": "NIC_RX_FILTER_CHANGED"}`)
+			if fail[cmd.Execute] {
+				fmt.Fprintf(conn, `{"error": {"class": "CommandNotFound", "desc": "The command %s has not been found"}}`+"\n", cmd.Execute)
+				continue
+			}
+			fmt.Fprintln(conn, `{"return": {}}`)
+		}
+	}()
+	return commands
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "qmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestAnnounceVMI(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "pod1", "domain-1-default_vm1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	commands := fakeQEMU(t, filepath.Join(dir, "pod1", "domain-1-default_vm1", "qmp.sock"), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pattern := filepath.Join(dir, "*", "domain-*-{namespace}_{name}", "qmp.sock")
+	if err := AnnounceVMI(ctx, pattern, "default", "vm1", Announce{Rounds: 5, Step: 100 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	want := []command{
+		{Execute: "qmp_capabilities"},
+		{Execute: "announce-self", Arguments: map[string]int64{"initial": 50, "max": 550, "rounds": 5, "step": 100}},
+	}
+	for _, w := range want {
+		if got := <-commands; !reflect.DeepEqual(got, w) {
+			t.Errorf("got %+v, want %+v", got, w)
+		}
+	}
+
+	if err := AnnounceVMI(ctx, pattern, "default", "vm2", Announce{Rounds: 1, Step: time.Millisecond}); err == nil {
+		t.Error("a vmi without socket should fail")
+	}
+}
+
+func TestAnnounceSelfError(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "qmp.sock")
+	fakeQEMU(t, path, map[string]bool{"announce-self": true})
+
+	c, err := Dial(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	err = c.AnnounceSelf(Announce{Rounds: 1, Step: time.Millisecond})
+	if qerr, ok := err.(*Error); !ok || qerr.Class != "CommandNotFound" {
+		t.Errorf("expected the error of qemu, got %v", err)
+	}
+}
+
+func TestSocket(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	var paths []string
+	for i, pod := range []string{"old", "new"} {
+		path := filepath.Join(dir, pod+"-default_vm1.sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		mtime := time.Now().Add(time.Duration(i-1) * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	// a regular file matching the pattern is not a socket
+	if err := ioutil.WriteFile(filepath.Join(dir, "file-default_vm1.sock"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Socket(filepath.Join(dir, "*-{namespace}_{name}.sock"), "default", "vm1")
+	if err != nil || got != paths[1] {
+		t.Errorf("Socket = %s, %v, want %s", got, err, paths[1])
+	}
+}
@@ -0,0 +1,173 @@
+// Package reachability tells whether a failover round restored the way out
+// of the vlans it announced on. For each vlan it asks the gateway for its mac
+// from the bridge, on behalf of an address the round announced, and expects
+// the reply back through the active slave of the bond: the switches only send
+// it there once they have learned the new path of the address.
+package reachability
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/garp"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sysClassNet is where the kernel publishes the bridge ports and bond state.
+var sysClassNet = "/sys/class/net"
+
+// Gateway is the gateway of a vlan to check, asked for on behalf of IP at
+// MAC.
+type Gateway struct {
+	Vlan    int
+	Bridge  string
+	Gateway string
+	IP      string
+	MAC     string
+}
+
+// Result is the outcome of the check of a gateway.
+type Result struct {
+	Gateway
+	// Slave is the active slave the reply was expected on.
+	Slave     string
+	Reachable bool
+	// GatewayMAC is the mac the gateway replied with.
+	GatewayMAC string
+	// Error tells why the gateway could not be checked.
+	Error string
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Error != "":
+		return fmt.Sprintf("gateway %s of vlan %d on %s: %s", r.Gateway.Gateway, r.Vlan, r.Bridge, r.Error)
+	case r.Reachable:
+		return fmt.Sprintf("gateway %s of vlan %d replied from %s on %s", r.Gateway.Gateway, r.Vlan, r.GatewayMAC, r.Slave)
+	}
+	return fmt.Sprintf("gateway %s of vlan %d did not reply to %s on %s", r.Gateway.Gateway, r.Vlan, r.IP, r.Slave)
+}
+
+// openCapture opens link for the requests or their replies; tests replace
+// it. The filter lets the tagged arp of a slave through.
+var openCapture = func(cfg *config.Config, link string) (garp.Capture, error) {
+	return garp.OpenCapture(link, cfg.SnapLen, "arp or (vlan and arp)")
+}
+
+// activeSlave returns the active slave of the monitored bond enslaved to
+// bridge, directly or by a vlan subinterface; tests replace it.
+var activeSlave = func(cfg *config.Config, bridge string) (string, error) {
+	ports, err := ioutil.ReadDir(filepath.Join(sysClassNet, bridge, "brif"))
+	if err != nil {
+		return "", err
+	}
+	for _, bond := range cfg.Bonds {
+		for _, port := range ports {
+			if port.Name() != bond && !strings.HasPrefix(port.Name(), bond+".") {
+				continue
+			}
+			data, err := ioutil.ReadFile(filepath.Join(sysClassNet, bond, "bonding", "active_slave"))
+			if err != nil {
+				return "", err
+			}
+			if slave := strings.TrimSpace(string(data)); slave != "" {
+				return slave, nil
+			}
+			return "", fmt.Errorf("bond %s has no active slave", bond)
+		}
+	}
+	return "", fmt.Errorf("no bond of %s is enslaved to %s", strings.Join(cfg.Bonds, ", "), bridge)
+}
+
+// Check asks the gateways side by side and returns their results within
+// cfg.GatewayWait, sorted by vlan.
+func Check(ctx context.Context, cfg *config.Config, gateways []Gateway) []Result {
+	var wg sync.WaitGroup
+	results := make([]Result, len(gateways))
+	for i := range gateways {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = check(ctx, cfg, gateways[i])
+		}(i)
+	}
+	wg.Wait()
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Vlan != results[j].Vlan {
+			return results[i].Vlan < results[j].Vlan
+		}
+		if results[i].Bridge != results[j].Bridge {
+			return results[i].Bridge < results[j].Bridge
+		}
+		return results[i].Gateway.Gateway < results[j].Gateway.Gateway
+	})
+	return results
+}
+
+// check asks the gateway of g from its bridge and listens for the reply on
+// the active slave, which it opens first so as not to miss a quick one.
+func check(ctx context.Context, cfg *config.Config, g Gateway) Result {
+	r := Result{Gateway: g}
+	gateway, ip := net.ParseIP(g.Gateway).To4(), net.ParseIP(g.IP).To4()
+	mac, err := net.ParseMAC(g.MAC)
+	if gateway == nil || ip == nil || err != nil {
+		r.Error = fmt.Sprintf("cannot ask ipv4 gateway %q for %q at %q", g.Gateway, g.IP, g.MAC)
+		return r
+	}
+	if r.Slave, err = activeSlave(cfg, g.Bridge); err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	listen, err := openCapture(cfg, r.Slave)
+	if err != nil {
+		r.Error = fmt.Sprintf("open %s: %v", r.Slave, err)
+		return r
+	}
+	defer listen.Close()
+	bridge, err := openCapture(cfg, g.Bridge)
+	if err != nil {
+		r.Error = fmt.Sprintf("open %s: %v", g.Bridge, err)
+		return r
+	}
+	defer bridge.Close()
+	data, err := garp.NewArpRequest(gateway, ip, garp.Broadcast, mac)
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	if err := bridge.WritePacketData(data); err != nil {
+		r.Error = fmt.Sprintf("write request on %s: %v", g.Bridge, err)
+		return r
+	}
+	deadline := time.Now().Add(cfg.GatewayWait.Duration)
+	for time.Now().Before(deadline) && ctx.Err() == nil {
+		data, _, err := listen.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil {
+			r.Error = fmt.Sprintf("read %s: %v", r.Slave, err)
+			return r
+		}
+		packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.NoCopy)
+		arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP)
+		if !ok || arp.Operation != layers.ARPReply {
+			continue
+		}
+		if net.IP(arp.SourceProtAddress).Equal(gateway) && net.IP(arp.DstProtAddress).Equal(ip) {
+			r.Reachable = true
+			r.GatewayMAC = net.HardwareAddr(arp.SourceHwAddress).String()
+			return r
+		}
+	}
+	return r
+}
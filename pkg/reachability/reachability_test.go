@@ -0,0 +1,153 @@
+package reachability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"ha-bridge/pkg/config"
+	"ha-bridge/pkg/garp"
+)
+
+// fakeCapture queues the frames written to it for reading, or has reply
+// answer the requests written on it.
+type fakeCapture struct {
+	mu    sync.Mutex
+	queue [][]byte
+	reply func(request *layers.ARP)
+}
+
+func (c *fakeCapture) WritePacketData(data []byte) error {
+	packet := gopacket.NewPacket(data, layers.LayerTypeEthernet, gopacket.Default)
+	if arp, ok := packet.Layer(layers.LayerTypeARP).(*layers.ARP); ok && c.reply != nil {
+		c.reply(arp)
+	}
+	return nil
+}
+
+func (c *fakeCapture) push(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.queue = append(c.queue, data)
+}
+
+func (c *fakeCapture) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.queue) == 0 {
+		time.Sleep(time.Millisecond)
+		return nil, gopacket.CaptureInfo{}, pcap.NextErrorTimeoutExpired
+	}
+	data := c.queue[0]
+	c.queue = c.queue[1:]
+	return data, gopacket.CaptureInfo{}, nil
+}
+
+func (c *fakeCapture) Close() {}
+
+// taggedReply builds the reply of gateway at mac to request, tagged with
+// vlan as it arrives on a slave.
+func taggedReply(t *testing.T, request *layers.ARP, mac string, vlan int) []byte {
+	hw, _ := net.ParseMAC(mac)
+	buffer := gopacket.NewSerializeBuffer()
+	err := gopacket.SerializeLayers(buffer, gopacket.SerializeOptions{FixLengths: true},
+		&layers.Ethernet{SrcMAC: hw, DstMAC: request.SourceHwAddress, EthernetType: layers.EthernetTypeDot1Q},
+		&layers.Dot1Q{VLANIdentifier: uint16(vlan), Type: layers.EthernetTypeARP},
+		&layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+			Operation: layers.ARPReply, SourceHwAddress: hw, SourceProtAddress: request.DstProtAddress,
+			DstHwAddress: request.SourceHwAddress, DstProtAddress: request.SourceProtAddress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestCheck(t *testing.T) {
+	slaves := map[string]*fakeCapture{"eth1": {}, "eth3": {}}
+	captures := map[string]*fakeCapture{
+		"eth1": slaves["eth1"],
+		"eth3": slaves["eth3"],
+		// the gateway of vlan 100 replies through eth1
+		"vlan100": {reply: func(request *layers.ARP) {
+			slaves["eth1"].push(taggedReply(t, request, "00:00:5e:00:01:01", 100))
+		}},
+		// the reply of the gateway of vlan 200 still takes the old slave
+		"vlan200": {reply: func(request *layers.ARP) {
+			slaves["eth3"].push(taggedReply(t, request, "00:00:5e:00:01:02", 200))
+		}},
+	}
+	savedOpen, savedSlave := openCapture, activeSlave
+	defer func() { openCapture, activeSlave = savedOpen, savedSlave }()
+	openCapture = func(cfg *config.Config, link string) (garp.Capture, error) {
+		if c, ok := captures[link]; ok {
+			return c, nil
+		}
+		return nil, errors.New("no such device")
+	}
+	activeSlave = func(cfg *config.Config, bridge string) (string, error) {
+		if bridge == "vlan300" {
+			return "", fmt.Errorf("no bond of bond0 is enslaved to %s", bridge)
+		}
+		return "eth1", nil
+	}
+	cfg := config.Default()
+	cfg.GatewayWait.Duration = 20 * time.Millisecond
+	results := Check(context.Background(), cfg, []Gateway{
+		{Vlan: 300, Bridge: "vlan300", Gateway: "10.0.3.1", IP: "10.0.3.2", MAC: "02:00:00:00:00:03"},
+		{Vlan: 200, Bridge: "vlan200", Gateway: "10.0.2.1", IP: "10.0.2.2", MAC: "02:00:00:00:00:02"},
+		{Vlan: 100, Bridge: "vlan100", Gateway: "10.0.1.1", IP: "10.0.1.2", MAC: "02:00:00:00:00:01"},
+	})
+	var got []string
+	for _, r := range results {
+		got = append(got, r.String())
+	}
+	want := []string{
+		"gateway 10.0.1.1 of vlan 100 replied from 00:00:5e:00:01:01 on eth1",
+		"gateway 10.0.2.1 of vlan 200 did not reply to 10.0.2.2 on eth1",
+		"gateway 10.0.3.1 of vlan 300 on vlan300: no bond of bond0 is enslaved to vlan300",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %q, want %q", got, want)
+	}
+	if !results[0].Reachable || results[1].Reachable || results[2].Reachable {
+		t.Errorf("only vlan 100 should be reachable: %+v", results)
+	}
+}
+
+func TestActiveSlave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reachability")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	saved := sysClassNet
+	defer func() { sysClassNet = saved }()
+	sysClassNet = dir
+	for _, path := range []string{"vlan100/brif/bond0.100", "vlan100/brif/vnet0", "bond0/bonding"} {
+		if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "bond0", "bonding", "active_slave"), []byte("eth1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default()
+	if slave, err := activeSlave(cfg, "vlan100"); err != nil || slave != "eth1" {
+		t.Errorf("activeSlave(vlan100) = %q, %v, want eth1", slave, err)
+	}
+	cfg.Bonds = []string{"bond1"}
+	if _, err := activeSlave(cfg, "vlan100"); err == nil {
+		t.Error("a bridge without a monitored bond should have no active slave")
+	}
+}
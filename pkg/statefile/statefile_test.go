@@ -0,0 +1,38 @@
+package statefile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statefile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+	var got map[string]string
+	if ok, err := Read(path, &got); ok || err != nil {
+		t.Fatalf("a missing file should read as none: %v, %v", ok, err)
+	}
+
+	if err := Write(path, map[string]string{"bond0": "eth1"}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Read(path, &got); !ok || err != nil || got["bond0"] != "eth1" {
+		t.Fatalf("read %v, %v, %v", got, ok, err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file was left behind: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(path, &got); err == nil {
+		t.Error("a corrupt file should not read")
+	}
+}
@@ -0,0 +1,100 @@
+// Package traffic reads the packet counters of the links of the node, by
+// which a round tells whether the traffic of a VM resumed: its bridge port
+// receives the unicast the VM sends, in answer to the traffic reaching it
+// again or on its own, and which teaches the switches its new path.
+package traffic
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// iflaStats64 is the IFLA_STATS64 link attribute of linux/if_link.h, which
+// syscall lacks.
+const iflaStats64 = 23
+
+// linkStats64 is the head of struct rtnl_link_stats64 of linux/if_link.h, up
+// to the multicast frames received.
+type linkStats64 struct {
+	RxPackets   uint64
+	TxPackets   uint64
+	RxBytes     uint64
+	TxBytes     uint64
+	RxErrors    uint64
+	TxErrors    uint64
+	RxDropped   uint64
+	TxDropped   uint64
+	RxMulticast uint64
+}
+
+const sizeofLinkStats64 = int(unsafe.Sizeof(linkStats64{}))
+
+// Counters is the number of unicast packets each link received, by link
+// name. On the host side of a tap or veth that is the traffic the VM sends.
+// Its broadcasts and multicasts, among them the announcements a round has
+// the guest send, tell nothing of whether the traffic to it resumed and are
+// left out.
+type Counters map[string]uint64
+
+// ReadCounters dumps the links of the node with their IFLA_STATS64.
+func ReadCounters() (Counters, error) {
+	data, err := syscall.NetlinkRIB(syscall.RTM_GETLINK, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, fmt.Errorf("dump links: %v", err)
+	}
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse links: %v", err)
+	}
+	return parseLinks(msgs), nil
+}
+
+// parseLinks reads the counters of the RTM_NEWLINK messages of a link dump.
+func parseLinks(msgs []syscall.NetlinkMessage) Counters {
+	counters := Counters{}
+	for i := range msgs {
+		if msgs[i].Header.Type != syscall.RTM_NEWLINK {
+			continue
+		}
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msgs[i])
+		if err != nil {
+			continue
+		}
+		var name string
+		var stats *linkStats64
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case syscall.IFLA_IFNAME:
+				if n := len(attr.Value); n > 0 && attr.Value[n-1] == 0 {
+					name = string(attr.Value[:n-1])
+				} else {
+					name = string(attr.Value)
+				}
+			case iflaStats64:
+				if len(attr.Value) >= sizeofLinkStats64 {
+					stats = (*linkStats64)(unsafe.Pointer(&attr.Value[0]))
+				}
+			}
+		}
+		if name != "" && stats != nil {
+			counters[name] = stats.RxPackets - stats.RxMulticast
+		}
+	}
+	return counters
+}
+
+// Grew tells whether any of ports passed packets between before and after.
+// A port missing from either has gone with its VM and tells nothing.
+func Grew(ports []string, before, after Counters) bool {
+	for _, port := range ports {
+		b, ok := before[port]
+		if !ok {
+			continue
+		}
+		if a, ok := after[port]; ok && a > b {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package traffic
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// linkMessage builds the RTM_NEWLINK message of the link name, with the
+// IFLA_STATS64 of stats unless nil.
+func linkMessage(typ uint16, name string, stats *linkStats64) syscall.NetlinkMessage {
+	data := make([]byte, syscall.SizeofIfInfomsg)
+	attr := func(typ uint16, value []byte) {
+		a := syscall.RtAttr{Len: uint16(syscall.SizeofRtAttr + len(value)), Type: typ}
+		data = append(data, (*[syscall.SizeofRtAttr]byte)(unsafe.Pointer(&a))[:]...)
+		data = append(data, value...)
+		for len(data)%syscall.RTA_ALIGNTO != 0 {
+			data = append(data, 0)
+		}
+	}
+	attr(syscall.IFLA_IFNAME, append([]byte(name), 0))
+	if stats != nil {
+		attr(iflaStats64, (*[sizeofLinkStats64]byte)(unsafe.Pointer(stats))[:])
+	}
+	return syscall.NetlinkMessage{Header: syscall.NlMsghdr{Type: typ}, Data: data}
+}
+
+func TestParseLinks(t *testing.T) {
+	msgs := []syscall.NetlinkMessage{
+		linkMessage(syscall.RTM_NEWLINK, "tap0", &linkStats64{RxPackets: 42, TxPackets: 7, RxMulticast: 12}),
+		linkMessage(syscall.RTM_NEWLINK, "tap1", nil),
+		linkMessage(syscall.RTM_DELLINK, "tap2", &linkStats64{RxPackets: 1}),
+	}
+	if got, want := parseLinks(msgs), (Counters{"tap0": 30}); !reflect.DeepEqual(got, want) {
+		t.Errorf("counters = %v, want only the unicast received", got)
+	}
+}
+
+func TestGrew(t *testing.T) {
+	before := Counters{"tap0": 10, "tap1": 5}
+	after := Counters{"tap0": 10, "tap1": 6}
+	if Grew([]string{"tap0"}, before, after) {
+		t.Error("tap0 passed no packets")
+	}
+	if !Grew([]string{"tap0", "tap1"}, before, after) {
+		t.Error("a vm receiving on any of its ports has recovered")
+	}
+	if Grew([]string{"tap2"}, before, Counters{"tap2": 3}) {
+		t.Error("a port without a first sample tells nothing")
+	}
+}